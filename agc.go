@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+const (
+	minGain = -50
+	maxGain = 50
+)
+
+func validateAGC() {
+	if *agc != "" && !owrx.ValidAGC(*agc) {
+		fatalf("Unknown -agc %q, use %s", *agc, strings.Join(owrx.AGCModes, ", "))
+	}
+	if *gain < minGain || *gain > maxGain {
+		fatalf("-gain must be between %d and %d dB, got %g", minGain, maxGain, *gain)
+	}
+	if explicitFlags()["gain"] && *agc != "off" {
+		warnf("-gain only applies with -agc off")
+	}
+}
+
+// cycleAGC steps the AGC through fast, slow and off. From the server's
+// own setting it starts at fast.
+func cycleAGC() {
+	updateDSP(func(s *owrx.DSP) {
+		next := owrx.AGCModes[0]
+		for i, m := range owrx.AGCModes {
+			if m == s.AGC {
+				next = owrx.AGCModes[(i+1)%len(owrx.AGCModes)]
+			}
+		}
+		s.AGC = next
+	})
+}
+
+// adjustGain changes the gain used with the AGC off.
+func adjustGain(delta float64) {
+	s := updateDSP(func(s *owrx.DSP) {
+		s.Gain += delta
+		if s.Gain < minGain {
+			s.Gain = minGain
+		}
+		if s.Gain > maxGain {
+			s.Gain = maxGain
+		}
+	})
+	if s.AGC != "off" {
+		warnf("the gain only applies with the AGC off")
+	}
+}
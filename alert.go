@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const alertWebhookTimeout = 5 * time.Second
+
+// alertEvent is posted to -alert-webhook when the smeter crosses
+// -alert-level.
+type alertEvent struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	Level     float64   `json:"level_db"`
+	Threshold float64   `json:"threshold_db"`
+	Frequency int64     `json:"frequency,omitempty"`
+}
+
+// alerter fires an event when the smeter rises above the alert level and
+// another once it has stayed below it for the hold time, so a signal
+// hovering around the level doesn't produce a burst of events.
+type alerter struct {
+	mu      sync.Mutex
+	level   squelchDetector
+	webhook string
+	client  *http.Client
+}
+
+func setupAlerts() {
+	if !explicitFlags()["alert-level"] {
+		return
+	}
+
+	a := &alerter{
+		level:   squelchDetector{level: *alertLevel, hang: *alertHold},
+		webhook: *alertWebhook,
+		client:  &http.Client{Timeout: alertWebhookTimeout},
+	}
+	addSmeterHandler(a.handleSmeter)
+}
+
+func (a *alerter) handleSmeter(r smeterReading) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := r.Time
+	db := smeterDB(r.Average)
+	opened, closed := a.level.update(db, now)
+	switch {
+	case opened:
+		a.fire(alertEvent{Time: now, Event: "above", Level: db})
+	case closed:
+		a.fire(alertEvent{Time: now, Event: "below", Level: db})
+	}
+}
+
+func (a *alerter) fire(event alertEvent) {
+	event.Threshold = a.level.level
+	if r := currentReceiver(); r.CenterFreq > 0 {
+		event.Frequency = r.CenterFreq + int64(currentDSP().OffsetFreq)
+	}
+
+	if event.Event == "above" {
+		infof("Alert: level %.1f dB above %.1f dB", event.Level, event.Threshold)
+	} else {
+		infof("Alert: level back below %.1f dB", event.Threshold)
+	}
+
+	if a.webhook != "" {
+		go a.post(event)
+	}
+}
+
+func (a *alerter) post(event alertEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		errorf("encoding alert: %v", err)
+		return
+	}
+
+	resp, err := a.client.Post(a.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		errorf("posting alert: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		errorf("posting alert: %s", resp.Status)
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// apiState is what GET /state returns.
+type apiState struct {
+	Connected  bool             `json:"connected"`
+	Server     *serverInfo      `json:"server,omitempty"`
+	Receiver   *receiverDetails `json:"receiver,omitempty"`
+	Profile    string           `json:"profile,omitempty"`
+	CenterFreq int64            `json:"center_freq,omitempty"`
+	Frequency  int64            `json:"frequency,omitempty"`
+	Offset     int              `json:"offset"`
+	Mode       string           `json:"mode"`
+	LowCut     int              `json:"low_cut"`
+	HighCut    int              `json:"high_cut"`
+	Squelch    int              `json:"squelch"`
+	AGC        string           `json:"agc,omitempty"`
+	Gain       *float64         `json:"gain,omitempty"`
+	DMRFilter  string           `json:"dmr_filter,omitempty"`
+	Smeter     *float64         `json:"smeter_db,omitempty"`
+	SmeterDBm  *float64         `json:"smeter_dbm,omitempty"`
+	Muted      bool             `json:"muted"`
+	Recording  bool             `json:"recording"`
+}
+
+// apiDSPRequest is the body of POST /dsp. Only the fields given are
+// changed; frequency takes precedence over offset.
+type apiDSPRequest struct {
+	Frequency *frequency      `json:"frequency"`
+	Offset    *int            `json:"offset"`
+	Mode      *string         `json:"mode"`
+	LowCut    *int            `json:"low_cut"`
+	HighCut   *int            `json:"high_cut"`
+	Squelch   *int            `json:"squelch"`
+	AGC       *string         `json:"agc"`
+	Gain      *float64        `json:"gain"`
+	DMRFilter *dmrFilterValue `json:"dmr_filter"`
+}
+
+// dmrFilterValue is a DMR filter preset name, or the bitmask as a number.
+type dmrFilterValue int
+
+func (f *dmrFilterValue) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		text = string(data)
+	}
+	filter, err := owrx.ParseDMRFilter(text)
+	if err != nil {
+		return err
+	}
+	*f = dmrFilterValue(filter)
+	return nil
+}
+
+type apiRecordingRequest struct {
+	File string `json:"file"`
+}
+
+// apiServer is the HTTP control API started with -api-addr.
+type apiServer struct {
+	server *http.Server
+
+	mu     sync.Mutex
+	smeter float64
+	seen   bool
+}
+
+var api *apiServer
+
+func validateRecordDir() {
+	if *recordDir == "" {
+		return
+	}
+	if info, err := os.Stat(*recordDir); err != nil {
+		fatalf("-record-dir: %v", err)
+	} else if !info.IsDir() {
+		fatalf("-record-dir %s is not a directory", *recordDir)
+	}
+}
+
+func setupAPI() {
+	if *apiAddr == "" {
+		return
+	}
+
+	api = &apiServer{}
+	addSmeterHandler(api.handleSmeter)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/state", api.handleState)
+	mux.HandleFunc("/dsp", api.handleDSP)
+	mux.HandleFunc("/mute", api.handleMute(true))
+	mux.HandleFunc("/unmute", api.handleMute(false))
+	mux.HandleFunc("/recording/start", api.handleRecordingStart)
+	mux.HandleFunc("/recording/stop", api.handleRecordingStop)
+	listener, err := net.Listen("tcp", *apiAddr)
+	if err != nil {
+		fatalf("API server: %v", err)
+	}
+	api.server = &http.Server{Handler: mux}
+	go func() {
+		if err := api.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			errorf("API server: %v", err)
+		}
+	}()
+	infof("Serving the control API on http://%s/", *apiAddr)
+}
+
+func closeAPI() {
+	if api == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	api.server.Shutdown(ctx)
+}
+
+func (a *apiServer) handleSmeter(r smeterReading) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.smeter = smeterDB(r.Average)
+	a.seen = true
+}
+
+func (a *apiServer) state() apiState {
+	r := currentReceiver()
+	s := currentDSP()
+	state := apiState{
+		Connected:  client.Connected(),
+		Server:     currentServer(),
+		Receiver:   currentDetails(),
+		Profile:    r.ProfileID,
+		CenterFreq: r.CenterFreq,
+		Offset:     s.OffsetFreq,
+		Mode:       s.Mod,
+		LowCut:     s.LowCut,
+		HighCut:    s.HighCut,
+		Squelch:    s.SquelchLevel,
+		AGC:        s.AGC,
+		Muted:      isMuted(),
+		Recording:  manual.active(),
+	}
+	if s.AGC == "off" {
+		gain := s.Gain
+		state.Gain = &gain
+	}
+	if s.Mod == "dmr" {
+		state.DMRFilter = owrx.DMRFilterName(s.DMRFilter)
+	}
+	state.Frequency = tunedFrequency(r, s.OffsetFreq)
+
+	a.mu.Lock()
+	if a.seen {
+		smeter := a.smeter
+		state.Smeter = &smeter
+		if smeterCalibrated {
+			dbm := smeterDBm(smeter)
+			state.SmeterDBm = &dbm
+		}
+	}
+	a.mu.Unlock()
+
+	return state
+}
+
+func (a *apiServer) handleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("use GET"))
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, a.state())
+}
+
+func (a *apiServer) handleDSP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+		return
+	}
+
+	var req apiDSPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	offset := req.Offset
+	if req.Frequency != nil {
+		receiver := currentReceiver()
+		if receiver.CenterFreq == 0 {
+			writeAPIError(w, http.StatusConflict, errors.New("the server hasn't sent its center frequency yet"))
+			return
+		}
+		o, err := receiver.offsetFor(int64(*req.Frequency))
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		offset = &o
+	}
+
+	var mode owrx.Mode
+	if req.Mode != nil {
+		var ok bool
+		if mode, ok = owrx.FindMode(*req.Mode); !ok {
+			writeAPIError(w, http.StatusBadRequest, errors.New("unknown mode "+*req.Mode))
+			return
+		}
+		if err := checkModeSupport(mode.Name); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if req.Squelch != nil && (*req.Squelch < minSquelch || *req.Squelch > maxSquelch) {
+		writeAPIError(w, http.StatusBadRequest, errors.New("squelch must be between -150 and 0"))
+		return
+	}
+	if req.AGC != nil && !owrx.ValidAGC(*req.AGC) {
+		writeAPIError(w, http.StatusBadRequest, errors.New("agc must be fast, slow or off"))
+		return
+	}
+	if req.Gain != nil && (*req.Gain < minGain || *req.Gain > maxGain) {
+		writeAPIError(w, http.StatusBadRequest, errors.New("gain must be between -50 and 50"))
+		return
+	}
+
+	current := currentDSP()
+	low, high := current.LowCut, current.HighCut
+	if req.Mode != nil {
+		next := current
+		next.SetMode(mode)
+		low, high = next.LowCut, next.HighCut
+	}
+	if req.LowCut != nil {
+		low = *req.LowCut
+	}
+	if req.HighCut != nil {
+		high = *req.HighCut
+	}
+	if low >= high {
+		writeAPIError(w, http.StatusBadRequest, errors.New("low_cut must be below high_cut"))
+		return
+	}
+
+	updateDSP(func(s *owrx.DSP) {
+		if offset != nil {
+			s.OffsetFreq = *offset
+		}
+		if req.Mode != nil {
+			s.Mod = mode.Name
+		}
+		s.LowCut, s.HighCut = low, high
+		if req.Squelch != nil {
+			s.SquelchLevel = *req.Squelch
+		}
+		if req.AGC != nil {
+			s.AGC = *req.AGC
+		}
+		if req.Gain != nil {
+			s.Gain = *req.Gain
+		}
+		if req.DMRFilter != nil {
+			s.DMRFilter = int(*req.DMRFilter)
+		}
+	})
+	writeAPIJSON(w, http.StatusOK, a.state())
+}
+
+func (a *apiServer) handleMute(m bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAPIError(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+			return
+		}
+
+		setMuted(m)
+		writeAPIJSON(w, http.StatusOK, a.state())
+	}
+}
+
+func (a *apiServer) handleRecordingStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+		return
+	}
+
+	var req apiRecordingRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	var template string
+	if req.File != "" {
+		var err error
+		if template, err = apiRecordingTemplate(req.File); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if err := manual.start(template); err != nil {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, a.state())
+}
+
+// apiRecordingTemplate places a requested recording name in -record-dir.
+// Only a bare file name is taken, so a request can't write anywhere else.
+func apiRecordingTemplate(name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("file %q must be a file name without a directory", name)
+	}
+	return filepath.Join(*recordDir, name), nil
+}
+
+func (a *apiServer) handleRecordingStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+		return
+	}
+
+	if err := manual.stop(); err != nil {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, a.state())
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIJSON(w, status, map[string]string{"error": err.Error()})
+}
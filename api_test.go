@@ -0,0 +1,25 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAPIRecordingTemplate(t *testing.T) {
+	*recordDir = "recs"
+	defer func() { *recordDir = "" }()
+
+	for _, name := range []string{"../x.wav", "/tmp/x.wav", `..\x.wav`, "sub/x.wav", ".", ".."} {
+		if got, err := apiRecordingTemplate(name); err == nil {
+			t.Errorf("apiRecordingTemplate(%q) = %q, want an error", name, got)
+		}
+	}
+
+	got, err := apiRecordingTemplate("rec_%H%M.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("recs", "rec_%H%M.wav"); got != want {
+		t.Errorf("apiRecordingTemplate = %q, want %q", got, want)
+	}
+}
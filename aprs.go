@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// aprsFrame is a decoded APRS or plain packet frame.
+type aprsFrame struct {
+	Source      string   `json:"source"`
+	Destination string   `json:"destination,omitempty"`
+	Path        []string `json:"path,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	Latitude    *float64 `json:"lat,omitempty"`
+	Longitude   *float64 `json:"lon,omitempty"`
+	Addressee   string   `json:"addressee,omitempty"`
+	Payload     string   `json:"payload,omitempty"`
+}
+
+// handleAprs logs a frame from the packet decoder and adds it to the -json
+// dump. Frames without a source are garbled beyond use and only logged at
+// debug level.
+func handleAprs(data owrx.AprsData) {
+	if data.Source == "" {
+		debugf("ignoring packet frame without a source: %+v", data)
+		return
+	}
+
+	f := aprsFrame{
+		Source:      data.Source,
+		Destination: data.Destination,
+		Path:        data.Path,
+		Type:        data.Type,
+		Addressee:   data.Addressee,
+		Payload:     strings.TrimSpace(data.Comment),
+	}
+	if data.Message != "" {
+		f.Payload = strings.TrimSpace(data.Message)
+	}
+	// A position needs both coordinates, and 0, 0 is what a broken
+	// encoder sends rather than a station in the Gulf of Guinea.
+	if data.Lat != nil && data.Lon != nil && (*data.Lat != 0 || *data.Lon != 0) {
+		f.Latitude, f.Longitude = data.Lat, data.Lon
+	}
+
+	infof("APRS %s", f)
+	dumpEvent("aprs", f)
+	recordDecoded("aprs", f)
+}
+
+func (f aprsFrame) String() string {
+	s := f.Source
+	if f.Destination != "" {
+		s += ">" + f.Destination
+	}
+	if len(f.Path) > 0 {
+		s += "," + strings.Join(f.Path, ",")
+	}
+
+	var parts []string
+	if f.Latitude != nil {
+		parts = append(parts, fmt.Sprintf("at %.4f, %.4f", *f.Latitude, *f.Longitude))
+	}
+	if f.Addressee != "" {
+		parts = append(parts, "to "+f.Addressee)
+	}
+	if f.Payload != "" {
+		parts = append(parts, f.Payload)
+	}
+	if len(parts) == 0 {
+		return s
+	}
+	return s + ": " + strings.Join(parts, " ")
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+const audioDropReportInterval = 10 * time.Second
+
+// AudioSink consumes decoded PCM audio.
+type AudioSink interface {
+	WriteAudio(frame owrx.AudioFrame) error
+}
+
+var (
+	// audioCompression is the compression last announced by the server,
+	// kept to log changes.
+	audioCompression string
+
+	sinksMu     sync.Mutex
+	audioSinks  []AudioSink
+	audioBuffer *AudioBuffer
+	audioPlayer *player
+	audioDone   chan struct{}
+)
+
+// rateLock pins a sink to the sample rate of the first frame it receives,
+// since none of the outputs can change rate mid-stream.
+type rateLock struct {
+	rate   int
+	warned bool
+}
+
+func (l *rateLock) accept(frame owrx.AudioFrame) bool {
+	if l.rate == 0 {
+		l.rate = frame.Rate
+	}
+	if frame.Rate == l.rate {
+		return true
+	}
+
+	if !l.warned {
+		l.warned = true
+		warnf("dropping %d Hz audio, output is locked to %d Hz", frame.Rate, l.rate)
+	}
+	return false
+}
+
+func addAudioSink(sink AudioSink) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+
+	audioSinks = append(audioSinks, sink)
+}
+
+func setupAudioOutputs() {
+	setupSidecars()
+
+	switch {
+	case *vox:
+		if *output == "" {
+			fatalf("-vox needs an output file name (-o)")
+		}
+		recorder := newVoxRecorder(*output)
+		addSquelchHandler(recorder.handleSquelch)
+		addAudioSink(recorder)
+	case *output != "":
+		rec, err := openRecording(*output, false)
+		if err != nil {
+			fatalf("Error starting recording: %v", err)
+		}
+		addAudioSink(rec)
+	}
+
+	// Recordings started with -record-signal or the API.
+	addAudioSink(manual)
+
+	if *raw {
+		addAudioSink(newPCMWriter(os.Stdout))
+	}
+
+	if *play {
+		p, err := newPlayer(*playCmd, *playLatency)
+		if err != nil {
+			fatalf("Failed to start playback: %v", err)
+		}
+		audioPlayer = p
+		addAudioSink(p)
+	}
+
+	if *level > 0 {
+		addAudioSink(newLevelMeter(*level, *levelWindow))
+	}
+
+	audioBuffer = NewAudioBuffer(time.Duration(*bufferMs) * time.Millisecond)
+	audioDone = make(chan struct{})
+	go runAudioSinks()
+	go reportAudioDrops()
+	if *audioStats > 0 {
+		go logAudioStats(*audioStats)
+	}
+
+	// Only now that the outputs are ready does audio go to them; until then
+	// the client holds it.
+	client.OnAudio(handleAudio)
+}
+
+// runAudioSinks moves audio from the buffer to the sinks, off the
+// connection's reader goroutine.
+func runAudioSinks() {
+	defer close(audioDone)
+
+	for {
+		frame, ok := audioBuffer.Read(0)
+		if !ok {
+			return
+		}
+
+		sinksMu.Lock()
+		for _, sink := range audioSinks {
+			if err := sink.WriteAudio(frame); err != nil {
+				errorf("writing audio: %v", err)
+			}
+		}
+		sinksMu.Unlock()
+	}
+}
+
+func reportAudioDrops() {
+	ticker := time.NewTicker(audioDropReportInterval)
+	defer ticker.Stop()
+
+	var reported uint64
+	for {
+		select {
+		case <-audioDone:
+			return
+		case <-ticker.C:
+			stats := audioBuffer.Stats()
+			if stats.Dropped > reported {
+				warnf("audio buffer overflow: dropped %d samples (%d total, capacity %v)", stats.Dropped-reported, stats.Dropped, stats.Capacity)
+				reported = stats.Dropped
+			}
+		}
+	}
+}
+
+// audioDrainer is a sink with audio of its own to finish before it is
+// closed, such as the playback buffer.
+type audioDrainer interface {
+	drain(deadline time.Time)
+}
+
+// closeAudioSinks hands the audio still buffered to the sinks and closes
+// them, which finishes the recordings. Draining stops at -drain-timeout, so
+// a stuck output can't hold up the exit.
+func closeAudioSinks() {
+	deadline := time.Now().Add(*drainTimeout)
+	if audioBuffer != nil {
+		stats := audioBuffer.Stats()
+		infof("Audio buffer: capacity %v, dropped %d samples", stats.Capacity, stats.Dropped)
+
+		audioBuffer.Finish()
+		if !waitAudioDone(deadline) {
+			warnf("audio outputs didn't take the last %v of audio within %v, dropping it", audioBuffer.Buffered().Round(time.Millisecond), *drainTimeout)
+			audioBuffer.Close()
+			if !waitAudioDone(time.Now().Add(*drainTimeout)) {
+				errorf("audio output stuck, not closing the outputs")
+				return
+			}
+		}
+	}
+
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+
+	for _, sink := range audioSinks {
+		if d, ok := sink.(audioDrainer); ok {
+			d.drain(deadline)
+		}
+	}
+	for _, sink := range audioSinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errorf("closing audio output: %v", err)
+			}
+		}
+	}
+	audioSinks = nil
+}
+
+// waitAudioDone waits until runAudioSinks returns or deadline passes, and
+// reports which came first.
+func waitAudioDone(deadline time.Time) bool {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-audioDone:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// resetAudio starts the resamplers afresh for a new connection.
+func resetAudio() {
+	resamplersMu.Lock()
+	defer resamplersMu.Unlock()
+
+	resamplers = map[bool]*resampler{}
+}
+
+// logCompression logs the compression of a stream when a config message
+// changes it.
+func logCompression(stream string, current *string, compression string) {
+	if compression != *current {
+		infof("%s compression: %s", stream, compression)
+	}
+	*current = compression
+}
+
+func handleAudio(frame owrx.AudioFrame) {
+	writeAudio(muteFrame(resampleFrame(frame)))
+}
+
+func writeAudio(frame owrx.AudioFrame) {
+	if audioBuffer != nil {
+		audioBuffer.Write(frame)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// AudioBuffer is a bounded queue of decoded audio holding at most capacity
+// worth of samples. Writing to a full buffer drops the oldest samples, so a
+// slow consumer loses audio instead of stalling the connection.
+type AudioBuffer struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	capacity time.Duration
+	frames   []owrx.AudioFrame
+	buffered time.Duration
+	dropped  uint64
+	overruns uint64
+	closed   bool
+}
+
+// AudioBufferStats is a snapshot of an AudioBuffer's fill level and losses.
+// Overruns counts the writes that had to drop audio.
+type AudioBufferStats struct {
+	Capacity time.Duration
+	Buffered time.Duration
+	Dropped  uint64
+	Overruns uint64
+}
+
+func NewAudioBuffer(capacity time.Duration) *AudioBuffer {
+	b := &AudioBuffer{capacity: capacity}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func frameDuration(frame owrx.AudioFrame) time.Duration {
+	if frame.Rate == 0 {
+		return 0
+	}
+	return time.Duration(len(frame.Samples)) * time.Second / time.Duration(frame.Rate)
+}
+
+// Write queues a frame and returns the number of samples dropped to make
+// room for it.
+func (b *AudioBuffer) Write(frame owrx.AudioFrame) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || len(frame.Samples) == 0 {
+		return 0
+	}
+
+	b.frames = append(b.frames, frame)
+	b.buffered += frameDuration(frame)
+
+	dropped := 0
+	for b.buffered > b.capacity && len(b.frames) > 0 {
+		oldest := &b.frames[0]
+		excess := int((b.buffered - b.capacity) * time.Duration(oldest.Rate) / time.Second)
+		if excess < 1 {
+			excess = 1
+		}
+
+		if excess >= len(oldest.Samples) {
+			dropped += len(oldest.Samples)
+			b.buffered -= frameDuration(*oldest)
+			b.frames = b.frames[1:]
+			continue
+		}
+
+		before := frameDuration(*oldest)
+		oldest.Samples = oldest.Samples[excess:]
+		b.buffered -= before - frameDuration(*oldest)
+		dropped += excess
+	}
+	b.dropped += uint64(dropped)
+	if dropped > 0 {
+		b.overruns++
+	}
+
+	b.cond.Signal()
+	return dropped
+}
+
+// Read blocks until audio is available and returns up to limit samples of the
+// oldest frame, or false once the buffer is closed.
+func (b *AudioBuffer) Read(limit int) (owrx.AudioFrame, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(b.frames) == 0 && !b.closed {
+		b.cond.Wait()
+	}
+	if len(b.frames) == 0 {
+		return owrx.AudioFrame{}, false
+	}
+	return b.take(limit), true
+}
+
+// TryRead is Read without blocking.
+func (b *AudioBuffer) TryRead(limit int) (owrx.AudioFrame, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.frames) == 0 {
+		return owrx.AudioFrame{}, false
+	}
+	return b.take(limit), true
+}
+
+func (b *AudioBuffer) take(limit int) owrx.AudioFrame {
+	frame := b.frames[0]
+	if limit > 0 && len(frame.Samples) > limit {
+		head := frame
+		head.Samples = frame.Samples[:limit]
+		b.frames[0].Samples = frame.Samples[limit:]
+		b.buffered -= frameDuration(head)
+		return head
+	}
+
+	b.frames = b.frames[1:]
+	b.buffered -= frameDuration(frame)
+	if len(b.frames) == 0 {
+		b.buffered = 0
+	}
+	return frame
+}
+
+func (b *AudioBuffer) Buffered() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buffered
+}
+
+func (b *AudioBuffer) Stats() AudioBufferStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return AudioBufferStats{
+		Capacity: b.capacity,
+		Buffered: b.buffered,
+		Dropped:  b.dropped,
+		Overruns: b.overruns,
+	}
+}
+
+// Finish stops taking audio but, unlike Close, keeps what is queued for the
+// readers, which get false once it has all been read.
+func (b *AudioBuffer) Finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.cond.Broadcast()
+}
+
+// Close discards any queued audio and wakes up blocked readers.
+func (b *AudioBuffer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.frames = nil
+	b.buffered = 0
+	b.cond.Broadcast()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// audioPipelineStats is where received audio waits on its way out: in the
+// buffer in front of the sinks and, with -play, in the playback jitter
+// buffer.
+type audioPipelineStats struct {
+	Buffer    AudioBufferStats
+	Playback  *AudioBufferStats
+	Underruns int
+}
+
+func currentAudioStats() audioPipelineStats {
+	s := audioPipelineStats{Buffer: audioBuffer.Stats()}
+	if audioPlayer != nil {
+		playback, underruns := audioPlayer.stats()
+		s.Playback = &playback
+		s.Underruns = underruns
+	}
+	return s
+}
+
+// Overruns counts the times a buffer was full and audio had to be dropped.
+func (s audioPipelineStats) Overruns() uint64 {
+	overruns := s.Buffer.Overruns
+	if s.Playback != nil {
+		overruns += s.Playback.Overruns
+	}
+	return overruns
+}
+
+// Latency estimates how long audio takes from arriving to being played or
+// written out. It leaves out the network and the sound device's buffer,
+// which the client can't see.
+func (s audioPipelineStats) Latency() time.Duration {
+	latency := s.Buffer.Buffered
+	if s.Playback != nil {
+		latency += s.Playback.Buffered
+	}
+	return latency
+}
+
+func (s audioPipelineStats) String() string {
+	text := fmt.Sprintf("buffer %v of %v", s.Buffer.Buffered.Round(time.Millisecond), s.Buffer.Capacity)
+	if s.Playback != nil {
+		text += fmt.Sprintf(", playback %v of %v, %d underruns", s.Playback.Buffered.Round(time.Millisecond), s.Playback.Capacity, s.Underruns)
+	}
+	return text + fmt.Sprintf(", %d overruns, latency %v", s.Overruns(), s.Latency().Round(time.Millisecond))
+}
+
+// logAudioStats logs the state of the audio pipeline every interval, which
+// helps tell a too small -buffer-ms or -play-latency from network trouble.
+func logAudioStats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-audioDone:
+			return
+		case <-ticker.C:
+			infof("Audio: %s", currentAudioStats())
+		}
+	}
+}
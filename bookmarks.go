@@ -0,0 +1,149 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// bookmark is a named frequency the server offers, either a bookmark or a
+// dial frequency of a digital mode, which is named after the mode.
+type bookmark struct {
+	Name      string `json:"name"`
+	Frequency int64  `json:"frequency"`
+	Mode      string `json:"mode,omitempty"`
+}
+
+var (
+	bookmarksMu     sync.Mutex
+	serverBookmarks = map[string][]bookmark{}
+	bookmarkApplied bool
+)
+
+func validateBookmark() {
+	if *bookmarkName == "" {
+		return
+	}
+	if *tuneFreq != 0 || *scanStart != 0 || *scanList != "" || explicitFlags()["offset"] {
+		fatalf("-bookmark can't be used with -freq, -offset, -scan-start or -scan-list")
+	}
+}
+
+func serverBookmarkList(list []owrx.Bookmark) []bookmark {
+	var marks []bookmark
+	for _, b := range list {
+		if b.Name != "" && b.Frequency > 0 {
+			marks = append(marks, bookmark{Name: b.Name, Frequency: b.Frequency, Mode: b.Modulation})
+		}
+	}
+	return marks
+}
+
+// dialFrequencyList names the dial frequencies after their mode.
+func dialFrequencyList(list []owrx.DialFrequency) []bookmark {
+	var marks []bookmark
+	for _, f := range list {
+		if f.Mode != "" && f.Frequency > 0 {
+			marks = append(marks, bookmark{Name: f.Mode, Frequency: f.Frequency})
+		}
+	}
+	return marks
+}
+
+// handleBookmarks stores the entries of a bookmarks or dial_frequencies
+// message, each replacing the previous list of its kind.
+func handleBookmarks(kind string, marks []bookmark) {
+	bookmarksMu.Lock()
+	serverBookmarks[kind] = marks
+	bookmarksMu.Unlock()
+
+	logBookmarks(kind, marks)
+	dumpEvent(kind, marks)
+	applyBookmark()
+}
+
+func logBookmarks(kind string, marks []bookmark) {
+	if len(marks) == 0 {
+		return
+	}
+
+	title := "Bookmarks"
+	if kind == "dial_frequencies" {
+		title = "Dial frequencies"
+	}
+	infof("%s:", title)
+	for _, b := range marks {
+		if b.Mode != "" && kind == "bookmarks" {
+			infof("  %s %s (%s)", formatMHz(b.Frequency), b.Name, b.Mode)
+		} else {
+			infof("  %s %s", formatMHz(b.Frequency), b.Name)
+		}
+	}
+}
+
+// findBookmark looks name up case-insensitively, preferring bookmarks over
+// dial frequencies and entries within the current profile.
+func findBookmark(name string, r receiverState) (bookmark, bool) {
+	bookmarksMu.Lock()
+	defer bookmarksMu.Unlock()
+
+	var found []bookmark
+	for _, kind := range []string{"bookmarks", "dial_frequencies"} {
+		for _, b := range serverBookmarks[kind] {
+			if strings.EqualFold(b.Name, name) {
+				found = append(found, b)
+			}
+		}
+	}
+	for _, b := range found {
+		if _, err := r.offsetFor(b.Frequency); err == nil {
+			return b, true
+		}
+	}
+	if len(found) > 0 {
+		return found[0], true
+	}
+	return bookmark{}, false
+}
+
+func bookmarkNames() []string {
+	bookmarksMu.Lock()
+	defer bookmarksMu.Unlock()
+
+	var names []string
+	for _, b := range serverBookmarks["bookmarks"] {
+		names = append(names, b.Name)
+	}
+	return names
+}
+
+// applyBookmark tunes to -bookmark, once, as soon as the server has sent
+// it and the profile's center frequency.
+func applyBookmark() {
+	r := currentReceiver()
+	if *bookmarkName == "" || bookmarkApplied || r.CenterFreq == 0 || profilePending(r) {
+		return
+	}
+
+	b, ok := findBookmark(*bookmarkName, r)
+	if !ok {
+		errorf("no bookmark %q (available: %s)", *bookmarkName, strings.Join(bookmarkNames(), ", "))
+		return
+	}
+	offset, err := r.offsetFor(b.Frequency)
+	if err != nil {
+		errorf("bookmark %s at %v", b.Name, err)
+		return
+	}
+	bookmarkApplied = true
+
+	mode, known := owrx.FindMode(b.Mode)
+	infof("Tuning to bookmark %s at %s", b.Name, formatMHz(b.Frequency))
+	updateDSP(func(s *owrx.DSP) {
+		s.OffsetFreq = offset
+		if known {
+			s.SetMode(mode)
+		}
+	})
+}
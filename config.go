@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// envPrefix starts the environment variable for each flag, e.g. OWRXP_SQ
+// for -sq and OWRXP_PING_INTERVAL for -ping-interval.
+const envPrefix = "OWRXP_"
+
+// pinnedFlags are the flags set on the command line or from the
+// environment, which the -config file doesn't override.
+var pinnedFlags map[string]bool
+
+// loadConfig resolves the settings not given on the command line: from
+// OWRXP_* environment variables first, then from the -config file, a JSON
+// object keyed by flag name.
+func loadConfig() {
+	skip := explicitFlags()
+	if err := applyEnv(skip); err != nil {
+		fatalf("Failed to load environment: %v", err)
+	}
+	pinnedFlags = skip
+
+	if *configFile == "" {
+		if *profile != "" {
+			fatalf("-profile %s needs a -config file", *profile)
+		}
+		if *receiverName != "" {
+			fatalf("-receiver %s needs a -config file", *receiverName)
+		}
+		return
+	}
+
+	values, err := readConfig(*configFile)
+	if err != nil {
+		fatalf("Failed to load config: %v", err)
+	}
+
+	values, err = selectProfile(values)
+	if err != nil {
+		fatalf("Failed to load config %s: %v", *configFile, err)
+	}
+	values, err = selectReceiver(values)
+	if err != nil {
+		fatalf("Failed to load config %s: %v", *configFile, err)
+	}
+	if err := applyConfig(values, skip); err != nil {
+		fatalf("Failed to load config %s: %v", *configFile, err)
+	}
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets each flag not in skip from its environment variable and
+// adds it to skip, so the config file doesn't override it.
+func applyEnv(skip map[string]bool) error {
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || skip[f.Name] || err != nil {
+			return
+		}
+		if setErr := flag.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("%s: %v", envName(f.Name), setErr)
+			return
+		}
+		skip[f.Name] = true
+	})
+	return err
+}
+
+// selectProfile merges the profile chosen with -profile, or with a
+// "profile" key in the file, over the file's top-level settings.
+func selectProfile(values map[string]interface{}) (map[string]interface{}, error) {
+	profiles, _ := values["profiles"].(map[string]interface{})
+	delete(values, "profiles")
+
+	name := *profile
+	if name == "" {
+		name, _ = values["profile"].(string)
+	}
+	delete(values, "profile")
+	if name == "" {
+		return values, nil
+	}
+
+	settings, ok := profiles[name].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("no profile %q (available: %s)", name, strings.Join(profileNames(profiles), ", "))
+	}
+	for key, value := range settings {
+		values[key] = value
+	}
+	return values, nil
+}
+
+// selectReceiver merges the entry of the file's receivers chosen with
+// -receiver over the other settings. Without -receiver the entries are kept
+// in receiverEntries, for runReceivers to run them all.
+func selectReceiver(values map[string]interface{}) (map[string]interface{}, error) {
+	receivers, _ := values["receivers"].(map[string]interface{})
+	delete(values, "receivers")
+
+	if *receiverName == "" {
+		receiverLabels = profileNames(receivers)
+		receiverEntries = make(map[string]map[string]interface{})
+		for _, label := range receiverLabels {
+			settings, ok := receivers[label].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("receiver %q is not an object", label)
+			}
+			receiverEntries[label] = settings
+		}
+		return values, nil
+	}
+
+	settings, ok := receivers[*receiverName].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("no receiver %q (available: %s)", *receiverName, strings.Join(profileNames(receivers), ", "))
+	}
+	for key, value := range settings {
+		values[key] = value
+	}
+	return values, nil
+}
+
+func profileNames(profiles map[string]interface{}) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readConfig(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var values map[string]interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return values, nil
+}
+
+// explicitFlags returns the names of the flags set on the command line.
+func explicitFlags() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// applyConfig sets each flag named in values unless it is in skip. An array
+// sets a repeatable flag such as -header once per element.
+func applyConfig(values map[string]interface{}, skip map[string]bool) error {
+	for name, value := range values {
+		if name == "config" || name == "profile" || name == "receiver" {
+			continue
+		}
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("unknown setting %q", name)
+		}
+		if skip[name] {
+			continue
+		}
+
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		for _, item := range items {
+			if err := flag.Set(name, configString(item)); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func configString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// receiverDetails is what the operator tells about the receiver in the
+// receiver_details message.
+type receiverDetails struct {
+	Name        string   `json:"name,omitempty"`
+	Location    string   `json:"location,omitempty"`
+	Altitude    float64  `json:"asl,omitempty"`
+	Admin       string   `json:"admin,omitempty"`
+	Latitude    *float64 `json:"lat,omitempty"`
+	Longitude   *float64 `json:"lon,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+var (
+	detailsMu sync.Mutex
+	details   *receiverDetails
+)
+
+func currentDetails() *receiverDetails {
+	detailsMu.Lock()
+	defer detailsMu.Unlock()
+
+	return details
+}
+
+func handleReceiverDetails(value owrx.ReceiverDetails) {
+	d := &receiverDetails{
+		Name:     value.Name,
+		Location: value.Location,
+		Altitude: value.Altitude,
+		Admin:    value.Admin,
+		// The photo description is where operators usually describe the
+		// antenna and the rest of the station.
+		Description: stripTags(value.PhotoTitle + " " + value.PhotoDesc),
+	}
+	if gps := value.GPS; gps != nil {
+		d.Latitude, d.Longitude = &gps.Lat, &gps.Lon
+	}
+
+	detailsMu.Lock()
+	details = d
+	detailsMu.Unlock()
+
+	infof("Receiver: %s", d)
+	if d.Description != "" {
+		infof("  %s", d.Description)
+	}
+}
+
+func (d *receiverDetails) String() string {
+	name := d.Name
+	if name == "" {
+		name = "unnamed"
+	}
+	var parts []string
+	if d.Location != "" {
+		parts = append(parts, d.Location)
+	}
+	if d.Altitude != 0 {
+		parts = append(parts, fmt.Sprintf("%g m ASL", d.Altitude))
+	}
+	if d.Latitude != nil {
+		parts = append(parts, fmt.Sprintf("%.4f, %.4f", *d.Latitude, *d.Longitude))
+	}
+	if d.Admin != "" {
+		parts = append(parts, "admin "+d.Admin)
+	}
+	if len(parts) == 0 {
+		return name
+	}
+	return name + " (" + strings.Join(parts, ", ") + ")"
+}
+
+// stripTags drops the HTML markup operators tend to put in the photo
+// description.
+func stripTags(s string) string {
+	var b strings.Builder
+	inTag := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>':
+			inTag = false
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// serverScheme splits -addr into scheme and host. A ws://, wss://, http:// or
+// https:// prefix picks the scheme, otherwise -tls decides.
+func serverScheme() (scheme, host string) {
+	return addrScheme(*addr)
+}
+
+// addrScheme splits a -addr value into the scheme to connect with and the
+// host and port.
+func addrScheme(addr string) (scheme, host string) {
+	host = addr
+	secure := *useTLS
+	for _, prefix := range []struct {
+		scheme string
+		tls    bool
+	}{
+		{"ws://", false},
+		{"http://", false},
+		{"wss://", true},
+		{"https://", true},
+	} {
+		if strings.HasPrefix(host, prefix.scheme) {
+			host = strings.TrimPrefix(host, prefix.scheme)
+			secure = prefix.tls
+			break
+		}
+	}
+	host = strings.TrimSuffix(host, "/")
+
+	if secure {
+		return "wss", host
+	}
+	return "ws", host
+}
+
+func validatePath() {
+	if !strings.HasPrefix(*wsPath, "/") {
+		fatalf("-path must start with /, got %q", *wsPath)
+	}
+}
+
+// clientOptions translates the connection and demodulator flags into
+// client options.
+func clientOptions() []owrx.Option {
+	mode, _ := owrx.FindMode(*mod)
+	low, high := startCuts(mode)
+	scheme, _ := serverScheme()
+	opts := append(connectionOptions(scheme),
+		owrx.WithMode(mode.Name),
+		owrx.WithPassband(low, high),
+		owrx.WithOffset(*freqOffset),
+		owrx.WithSquelch(*squelch),
+		owrx.WithDMRFilter(dmrFilter),
+		owrx.WithSecondary(*secondary),
+		owrx.WithNoiseReduction(*noiseReduction, *nrLevel),
+		owrx.WithNotch(*autoNotch, notchFreqs...),
+	)
+	if *agc != "" {
+		opts = append(opts, owrx.WithAGC(*agc, *gain))
+	}
+	if *ctcss != 0 {
+		opts = append(opts, owrx.WithCTCSS(*ctcss))
+	}
+	return opts
+}
+
+// connectionOptions are the options for how to connect and stay connected,
+// which runReceivers gives every receiver alike.
+func connectionOptions(scheme string) []owrx.Option {
+	opts := []owrx.Option{
+		owrx.WithPath(*wsPath),
+		owrx.WithHeader(requestHeader()),
+		owrx.WithConnectTimeout(*connectTimeout),
+		owrx.WithKeepalive(*pingInterval, *pingTimeout),
+		owrx.WithOutputRates(*outputRate, *hdOutputRate),
+	}
+	if scheme == "wss" {
+		opts = append(opts, owrx.WithTLS(&tls.Config{
+			InsecureSkipVerify: *insecure,
+		}))
+	}
+	if *dryRun {
+		opts = append(opts, owrx.WithDryRun())
+	}
+	if *reconnect {
+		opts = append(opts, owrx.WithReconnect(*backoffBase, *backoffMax), owrx.WithReconnectLimit(*reconnectMax))
+	}
+	return opts
+}
+
+// headerFlags collects repeated -header key=value flags.
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("header %q is not in key=value form", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+func requestHeader() http.Header {
+	header := http.Header{}
+	for _, h := range extraHeaders {
+		i := strings.Index(h, "=")
+		header.Add(strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:]))
+	}
+
+	if *user != "" || *pass != "" {
+		req := http.Request{Header: header}
+		req.SetBasicAuth(*user, *pass)
+	}
+	return header
+}
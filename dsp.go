@@ -0,0 +1,32 @@
+package main
+
+import "net.wadon/owrxp-playground/owrx"
+
+// currentDSP returns the demodulator setup last applied.
+func currentDSP() owrx.DSP {
+	return client.DSP()
+}
+
+// updateDSP applies change to the demodulator setup and sends the result
+// on the active connection, if there is one. It returns the new setup.
+func updateDSP(change func(s *owrx.DSP)) owrx.DSP {
+	before := currentDSP()
+	s, err := client.UpdateDSP(change)
+	if err != nil {
+		errorf("sending DSP settings: %v", err)
+	}
+	if s.OffsetFreq != before.OffsetFreq {
+		logTuning(currentReceiver(), s.OffsetFreq)
+	}
+	return s
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"os"
+	"time"
+)
+
+const (
+	eventCSVQueue         = 256
+	eventCSVFlushInterval = time.Second
+)
+
+// eventCSVWriter appends a row per decoded event, such as a WSPR spot, or
+// per smeter reading, on its own goroutine. It writes a header to an empty
+// file and flushes once a second, so little is lost if the process dies.
+// The FFT writers have their own, as their header waits for the first line.
+type eventCSVWriter struct {
+	name    string
+	file    *os.File
+	buf     *bufio.Writer
+	csv     *csv.Writer
+	rows    chan []string
+	done    chan struct{}
+	dropped int
+}
+
+// openEventCSV opens path for appending rows of the given columns; name
+// says what the rows are in messages.
+func openEventCSV(name, path string, header []string) (*eventCSVWriter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	buf := bufio.NewWriter(file)
+	w := &eventCSVWriter{
+		name: name,
+		file: file,
+		buf:  buf,
+		csv:  csv.NewWriter(buf),
+		rows: make(chan []string, eventCSVQueue),
+		done: make(chan struct{}),
+	}
+	if info.Size() == 0 {
+		w.csv.Write(header)
+	}
+	go w.run()
+
+	return w, nil
+}
+
+func (w *eventCSVWriter) write(row []string) {
+	select {
+	case w.rows <- row:
+	default:
+		w.dropped++
+	}
+}
+
+func (w *eventCSVWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(eventCSVFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case row, ok := <-w.rows:
+			if !ok {
+				return
+			}
+			if err := w.csv.Write(row); err != nil {
+				errorf("writing %s CSV: %v", w.name, err)
+			}
+		case <-ticker.C:
+			w.flush()
+		}
+	}
+}
+
+func (w *eventCSVWriter) flush() {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		errorf("writing %s CSV: %v", w.name, err)
+		return
+	}
+	if err := w.buf.Flush(); err != nil {
+		errorf("writing %s CSV: %v", w.name, err)
+	}
+}
+
+func (w *eventCSVWriter) Close() error {
+	close(w.rows)
+	<-w.done
+
+	if w.dropped > 0 {
+		warnf("%s CSV: dropped %d rows", w.name, w.dropped)
+	}
+
+	w.flush()
+	return w.file.Close()
+}
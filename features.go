@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// modeFeatures names the server feature each mode needs, as reported in
+// the features message. Modes missing here need nothing beyond the core.
+var modeFeatures = map[string]string{
+	"dmr":    "digital_voice_digiham",
+	"ysf":    "digital_voice_digiham",
+	"dstar":  "digital_voice_dsd",
+	"nxdn":   "digital_voice_dsd",
+	"m17":    "digital_voice_m17",
+	"freedv": "digital_voice_freedv",
+	"ft8":    "wsjt-x",
+	"ft4":    "wsjt-x",
+	"wspr":   "wsjt-x",
+	"jt65":   "wsjt-x",
+	"jt9":    "wsjt-x",
+	"fst4":   "wsjt-x",
+	"fst4w":  "wsjt-x",
+	"q65":    "wsjt-x",
+	"msk144": "wsjt-x",
+	"js8":    "js8call",
+	"packet": "packet",
+	"pocsag": "pocsag",
+}
+
+var (
+	featuresMu     sync.Mutex
+	serverFeatures map[string]bool
+)
+
+func handleFeatures(features map[string]bool) {
+	featuresMu.Lock()
+	serverFeatures = features
+	featuresMu.Unlock()
+
+	applyNR(features)
+
+	s := currentDSP()
+	for _, mode := range []string{s.Mod, s.SecondaryMod} {
+		if err := checkModeSupport(mode); err != nil {
+			errorf("%v, so there will be nothing to hear or decode", err)
+		}
+	}
+}
+
+// checkModeSupport returns an error if the server said it lacks the
+// feature mode needs. Before the features message arrives every mode
+// passes.
+func checkModeSupport(mode string) error {
+	feature, ok := modeFeatures[mode]
+	if !ok {
+		return nil
+	}
+
+	featuresMu.Lock()
+	defer featuresMu.Unlock()
+
+	if serverFeatures == nil || serverFeatures[feature] {
+		return nil
+	}
+	return fmt.Errorf("the server can't run mode %s, it lacks the %s feature", mode, feature)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FFTFrame is one waterfall line: spectrum magnitudes in dB across the
+// receiver bandwidth, lowest frequency first.
+type FFTFrame struct {
+	Time time.Time
+	Bins []float32
+}
+
+var (
+	fftMu       sync.Mutex
+	fftHandlers []func(frame FFTFrame)
+	fftClosers  []io.Closer
+
+	// fftCompression is the compression last announced by the server,
+	// kept to log changes.
+	fftCompression = "none"
+
+	fftRate fftRateLimit
+)
+
+// fftRateLimit is the -fft-rate flag: a number caps the FFT outputs to that
+// many frames per second, 1/N keeps one of every N frames. The frames left
+// out are still read off the connection, only not passed on.
+type fftRateLimit struct {
+	every    int
+	interval time.Duration
+	text     string
+
+	count int
+	last  time.Time
+}
+
+func (l *fftRateLimit) String() string {
+	return l.text
+}
+
+func (l *fftRateLimit) Set(value string) error {
+	if n := strings.TrimPrefix(value, "1/"); n != value {
+		every, err := strconv.Atoi(n)
+		if err != nil || every < 1 {
+			return fmt.Errorf("invalid %q, use 1/N with N a positive whole number", value)
+		}
+		*l = fftRateLimit{every: every, text: value}
+		return nil
+	}
+
+	fps, err := strconv.ParseFloat(value, 64)
+	if err != nil || fps < 0 {
+		return fmt.Errorf("invalid %q, use frames per second or 1/N", value)
+	}
+	*l = fftRateLimit{text: value}
+	if fps > 0 {
+		l.interval = time.Duration(float64(time.Second) / fps)
+	}
+	return nil
+}
+
+// keep tells whether the frame received at t goes to the outputs. A frame
+// arriving a little early is still kept, so jitter doesn't halve the rate.
+func (l *fftRateLimit) keep(t time.Time) bool {
+	switch {
+	case l.every > 1:
+		l.count++
+		return (l.count-1)%l.every == 0
+	case l.interval > 0:
+		if !l.last.IsZero() && t.Sub(l.last) < l.interval*9/10 {
+			return false
+		}
+		l.last = t
+	}
+	return true
+}
+
+func addFFTHandler(handler func(frame FFTFrame)) {
+	fftMu.Lock()
+	defer fftMu.Unlock()
+
+	fftHandlers = append(fftHandlers, handler)
+}
+
+func setupFFTOutputs() {
+	if *fftCSV != "" {
+		w, err := createFFTCSV(*fftCSV)
+		if err != nil {
+			fatalf("Failed to create %s: %v", *fftCSV, err)
+		}
+		addFFTHandler(w.handleFFT)
+		fftClosers = append(fftClosers, w)
+	}
+
+	if *fftRecord != "" {
+		w, err := createFFTRecord(*fftRecord)
+		if err != nil {
+			fatalf("Failed to create %s: %v", *fftRecord, err)
+		}
+		addFFTHandler(w.handleFFT)
+		fftClosers = append(fftClosers, w)
+	}
+
+	if *peaks {
+		detector := newPeakDetector(*peakThreshold, *peakSeparation)
+		detector.handlers = append(detector.handlers, detector.logPeaks)
+		if *jsonDump != "" {
+			detector.handlers = append(detector.handlers, dumpPeaks)
+		}
+		addFFTHandler(detector.handleFFT)
+	}
+
+	if *waterfallPNGFile != "" {
+		w := newWaterfallPNG(*waterfallPNGFile)
+		addFFTHandler(w.handleFFT)
+		fftClosers = append(fftClosers, w)
+	}
+
+	if *waterfall {
+		if *raw {
+			fatalf("-waterfall and -raw both need stdout")
+		}
+		if *tui {
+			fatalf("-waterfall and -tui can't share the terminal, -tui has its own waterfall")
+		}
+		addFFTHandler(newTerminalWaterfall(os.Stdout).handleFFT)
+	}
+
+	// Without outputs the FFT isn't even decoded.
+	if len(fftHandlers) > 0 {
+		client.OnFFT(handleFFT)
+	}
+}
+
+func closeFFTOutputs() {
+	fftMu.Lock()
+	fftHandlers = nil
+	closers := fftClosers
+	fftClosers = nil
+	fftMu.Unlock()
+
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			errorf("closing FFT output: %v", err)
+		}
+	}
+}
+
+func handleFFT(bins []float32) {
+	fftMu.Lock()
+	defer fftMu.Unlock()
+
+	frame := FFTFrame{Time: time.Now(), Bins: bins}
+	if !fftRate.keep(frame.Time) {
+		return
+	}
+	for _, handler := range fftHandlers {
+		handler(frame)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	fftCSVQueue         = 256
+	fftCSVFlushInterval = time.Second
+)
+
+// fftCSVWriter writes one row per FFT frame on its own goroutine, so a slow
+// disk drops frames instead of stalling the connection.
+type fftCSVWriter struct {
+	file    *os.File
+	buf     *bufio.Writer
+	csv     *csv.Writer
+	frames  chan FFTFrame
+	done    chan struct{}
+	dropped int
+
+	header   bool
+	bins     int
+	receiver receiverState
+}
+
+func createFFTCSV(path string) (*fftCSVWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bufio.NewWriter(file)
+	w := &fftCSVWriter{
+		file:   file,
+		buf:    buf,
+		csv:    csv.NewWriter(buf),
+		frames: make(chan FFTFrame, fftCSVQueue),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+
+	return w, nil
+}
+
+func (w *fftCSVWriter) handleFFT(frame FFTFrame) {
+	select {
+	case w.frames <- frame:
+	default:
+		w.dropped++
+	}
+}
+
+func (w *fftCSVWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(fftCSVFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case frame, ok := <-w.frames:
+			if !ok {
+				return
+			}
+			if err := w.write(frame); err != nil {
+				errorf("writing FFT CSV: %v", err)
+			}
+		case <-ticker.C:
+			w.flush()
+		}
+	}
+}
+
+func (w *fftCSVWriter) write(frame FFTFrame) error {
+	r := currentReceiver()
+	if !w.header {
+		w.header = true
+		w.bins = len(frame.Bins)
+		w.receiver = r
+
+		row := make([]string, 0, len(frame.Bins)+1)
+		row = append(row, "timestamp")
+		for i := range frame.Bins {
+			row = append(row, strconv.FormatInt(r.binFrequency(i, len(frame.Bins)), 10))
+		}
+		if err := w.csv.Write(row); err != nil {
+			return err
+		}
+	} else if len(frame.Bins) != w.bins || r != w.receiver {
+		warnf("FFT layout changed, the CSV header no longer matches the bins")
+		w.bins = len(frame.Bins)
+		w.receiver = r
+	}
+
+	row := make([]string, 0, len(frame.Bins)+1)
+	row = append(row, frame.Time.Format(time.RFC3339Nano))
+	for _, v := range frame.Bins {
+		row = append(row, strconv.FormatFloat(float64(v), 'f', 1, 32))
+	}
+	return w.csv.Write(row)
+}
+
+func (w *fftCSVWriter) flush() {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		errorf("writing FFT CSV: %v", err)
+		return
+	}
+	if err := w.buf.Flush(); err != nil {
+		errorf("writing FFT CSV: %v", err)
+	}
+}
+
+func (w *fftCSVWriter) Close() error {
+	close(w.frames)
+	<-w.done
+
+	if w.dropped > 0 {
+		warnf("FFT CSV: dropped %d frames", w.dropped)
+	}
+
+	w.flush()
+	return w.file.Close()
+}
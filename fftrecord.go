@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"math"
+	"os"
+	"time"
+)
+
+// An -fft-record file is fftRecordMagic followed by records, each a
+// little-endian uint32 length of what follows, a type byte and the payload.
+// A header record comes before the first frame and again whenever the
+// layout changes; readers skip types they don't know.
+const (
+	fftRecordMagic = "OWRXFFT1"
+
+	fftRecordHeader byte = 1
+	fftRecordFrame  byte = 2
+
+	// fftHeaderSize is the header record's payload: bins, sample rate,
+	// center frequency, start time and the server's waterfall levels.
+	fftHeaderSize = 4 + 4 + 8 + 8 + 4 + 4
+)
+
+// fftRecordWriter writes FFT frames to an -fft-record file on its own
+// goroutine, like fftCSVWriter, so a slow disk drops frames instead of
+// stalling the connection.
+type fftRecordWriter struct {
+	file    *os.File
+	buf     *bufio.Writer
+	frames  chan FFTFrame
+	done    chan struct{}
+	dropped int
+	failed  bool
+
+	header   bool
+	bins     int
+	receiver receiverState
+}
+
+func createFFTRecord(path string) (*fftRecordWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &fftRecordWriter{
+		file:   file,
+		buf:    bufio.NewWriter(file),
+		frames: make(chan FFTFrame, fftCSVQueue),
+		done:   make(chan struct{}),
+	}
+	if _, err := w.buf.WriteString(fftRecordMagic); err != nil {
+		file.Close()
+		return nil, err
+	}
+	go w.run()
+
+	return w, nil
+}
+
+func (w *fftRecordWriter) handleFFT(frame FFTFrame) {
+	select {
+	case w.frames <- frame:
+	default:
+		w.dropped++
+	}
+}
+
+func (w *fftRecordWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(fftCSVFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case frame, ok := <-w.frames:
+			if !ok {
+				return
+			}
+			if err := w.write(frame); err != nil && !w.failed {
+				// One error is enough, the rest would be the same.
+				w.failed = true
+				errorf("writing FFT recording: %v", err)
+			}
+		case <-ticker.C:
+			w.flush()
+		}
+	}
+}
+
+func (w *fftRecordWriter) write(frame FFTFrame) error {
+	r := currentReceiver()
+	if !w.header || len(frame.Bins) != w.bins || r != w.receiver {
+		w.header = true
+		w.bins = len(frame.Bins)
+		w.receiver = r
+		if err := w.writeHeader(frame.Time, r); err != nil {
+			return err
+		}
+	}
+
+	payload := make([]byte, 8+4*len(frame.Bins))
+	binary.LittleEndian.PutUint64(payload, uint64(frame.Time.UnixNano()))
+	for i, v := range frame.Bins {
+		binary.LittleEndian.PutUint32(payload[8+4*i:], math.Float32bits(v))
+	}
+	return w.writeRecord(fftRecordFrame, payload)
+}
+
+// writeHeader describes the frames that follow. Waterfall levels the
+// server didn't send are NaN.
+func (w *fftRecordWriter) writeHeader(start time.Time, r receiverState) error {
+	low, high := float32(math.NaN()), float32(math.NaN())
+	if r.waterfallSet {
+		low, high = r.WaterfallMin, r.WaterfallMax
+	}
+
+	payload := make([]byte, fftHeaderSize)
+	binary.LittleEndian.PutUint32(payload[0:], uint32(w.bins))
+	binary.LittleEndian.PutUint32(payload[4:], uint32(r.SampleRate))
+	binary.LittleEndian.PutUint64(payload[8:], uint64(r.CenterFreq))
+	binary.LittleEndian.PutUint64(payload[16:], uint64(start.UnixNano()))
+	binary.LittleEndian.PutUint32(payload[24:], math.Float32bits(low))
+	binary.LittleEndian.PutUint32(payload[28:], math.Float32bits(high))
+	return w.writeRecord(fftRecordHeader, payload)
+}
+
+func (w *fftRecordWriter) writeRecord(kind byte, payload []byte) error {
+	var prefix [5]byte
+	binary.LittleEndian.PutUint32(prefix[:], uint32(1+len(payload)))
+	prefix[4] = kind
+	if _, err := w.buf.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.buf.Write(payload)
+	return err
+}
+
+func (w *fftRecordWriter) flush() {
+	if err := w.buf.Flush(); err != nil && !w.failed {
+		w.failed = true
+		errorf("writing FFT recording: %v", err)
+	}
+}
+
+func (w *fftRecordWriter) Close() error {
+	close(w.frames)
+	<-w.done
+
+	if w.dropped > 0 {
+		warnf("FFT recording: dropped %d frames", w.dropped)
+	}
+
+	w.flush()
+	return w.file.Close()
+}
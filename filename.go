@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recordingTokens are the strftime-style tokens understood in -o names.
+var recordingTokens = map[byte]func(t time.Time) string{
+	'Y': func(t time.Time) string { return t.Format("2006") },
+	'y': func(t time.Time) string { return t.Format("06") },
+	'm': func(t time.Time) string { return t.Format("01") },
+	'd': func(t time.Time) string { return t.Format("02") },
+	'H': func(t time.Time) string { return t.Format("15") },
+	'M': func(t time.Time) string { return t.Format("04") },
+	'S': func(t time.Time) string { return t.Format("05") },
+	'j': func(t time.Time) string { return fmt.Sprintf("%03d", t.YearDay()) },
+	's': func(t time.Time) string { return strconv.FormatInt(t.Unix(), 10) },
+	'%': func(time.Time) string { return "%" },
+}
+
+// segmentSuffix is added to names without tokens where every recording
+// segment needs its own file, e.g. with -vox.
+const segmentSuffix = "_%Y%m%d_%H%M%S"
+
+func strftime(template string, t time.Time) string {
+	var b strings.Builder
+	for i := 0; i < len(template); i++ {
+		if template[i] == '%' && i+1 < len(template) {
+			if token, ok := recordingTokens[template[i+1]]; ok {
+				b.WriteString(token(t))
+				i++
+				continue
+			}
+		}
+		b.WriteByte(template[i])
+	}
+	return b.String()
+}
+
+func hasTimeTokens(template string) bool {
+	for i := 0; i+1 < len(template); i++ {
+		if template[i] != '%' {
+			continue
+		}
+		if template[i+1] == '%' {
+			i++
+			continue
+		}
+		if _, ok := recordingTokens[template[i+1]]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// recordingName expands the template for a recording started at t. If that
+// file already exists a counter is appended instead of overwriting it.
+func recordingName(template string, t time.Time, segmented bool) string {
+	if segmented && !hasTimeTokens(template) {
+		ext := filepath.Ext(template)
+		template = strings.TrimSuffix(template, ext) + segmentSuffix + ext
+	}
+
+	name := strftime(template, t)
+	if !fileExists(name) {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s_%d%s", stem, i, ext)
+		if !fileExists(candidate) {
+			return candidate
+		}
+	}
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
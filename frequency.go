@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// frequency is a flag value in Hz accepting forms such as 145500000,
+// 145.5M, 145.5MHz or 7074k.
+type frequency int64
+
+func newFrequency(hz int64) *frequency {
+	f := frequency(hz)
+	return &f
+}
+
+func (f *frequency) String() string {
+	return strconv.FormatInt(int64(*f), 10)
+}
+
+func (f *frequency) Set(value string) error {
+	multiplier := 1.0
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "HZ")
+	if n := len(number); n > 0 {
+		switch number[n-1] {
+		case 'K':
+			multiplier = 1e3
+		case 'M':
+			multiplier = 1e6
+		case 'G':
+			multiplier = 1e9
+		}
+		if multiplier > 1 {
+			number = strings.TrimSpace(number[:n-1])
+		}
+	}
+
+	v, err := strconv.ParseFloat(number, 64)
+	if err != nil || v < 0 {
+		return fmt.Errorf("invalid frequency %q", value)
+	}
+	*f = frequency(v*multiplier + 0.5)
+	return nil
+}
+
+// UnmarshalJSON accepts a number in Hz or a string in any form Set takes.
+func (f *frequency) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return f.Set(text)
+	}
+	return f.Set(string(data))
+}
+
+func formatMHz(hz int64) string {
+	return fmt.Sprintf("%.4f MHz", float64(hz)/1e6)
+}
+
+func validateFrequency() {
+	set := explicitFlags()
+	if set["freq"] && set["offset"] {
+		fatalf("-freq and -offset can't be used together")
+	}
+}
+
+// tuneToFrequency sets the offset that puts -freq in the passband once the
+// profile's center frequency is known, and again whenever it changes.
+func tuneToFrequency(before, after receiverState) {
+	if *tuneFreq == 0 || after.CenterFreq == 0 || after.CenterFreq == before.CenterFreq || profilePending(after) {
+		return
+	}
+
+	target := int64(*tuneFreq)
+	offset, err := after.offsetFor(target)
+	if err != nil {
+		errorf("-freq %v; pick another profile", err)
+		return
+	}
+
+	updateDSP(func(s *owrx.DSP) {
+		s.OffsetFreq = offset
+	})
+}
+
+// tunedFrequency is the frequency the demodulator is on, the profile's
+// center frequency plus the offset, or 0 before the center is known.
+func tunedFrequency(r receiverState, offset int) int64 {
+	if r.CenterFreq <= 0 {
+		return 0
+	}
+	return r.CenterFreq + int64(offset)
+}
+
+// formatTuning shows the tuned frequency along with the offset it comes
+// from, or only the offset before the center frequency is known.
+func formatTuning(r receiverState, offset int) string {
+	if freq := tunedFrequency(r, offset); freq != 0 {
+		return fmt.Sprintf("%s (offset %+d Hz)", formatMHz(freq), offset)
+	}
+	return fmt.Sprintf("offset %+d Hz", offset)
+}
+
+// logTuning logs the frequency whenever the offset or the center frequency
+// changes; while scanning only at debug level, as the scanner retunes
+// every -dwell.
+func logTuning(r receiverState, offset int) {
+	if scan != nil {
+		debugf("Tuned to %s", formatTuning(r, offset))
+		return
+	}
+	infof("Tuned to %s", formatTuning(r, offset))
+}
+
+// offsetFor returns the offset from the center frequency that tunes to
+// freq, or an error if freq lies outside the profile.
+func (r receiverState) offsetFor(freq int64) (int, error) {
+	offset := freq - r.CenterFreq
+	if half := r.SampleRate / 2; r.SampleRate > 0 && (offset < -half || offset > half) {
+		return 0, fmt.Errorf("%s is outside the profile, which covers %s to %s", formatMHz(freq), formatMHz(r.CenterFreq-half), formatMHz(r.CenterFreq+half))
+	}
+	return int(offset), nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// ft8Wait is how long decodes of a cycle are collected after the first one
+// arrives. The decoder sends a cycle's decodes in a burst shortly after the
+// cycle ends, well within this.
+const ft8Wait = 3 * time.Second
+
+// ft8CycleLengths are the transmit periods of the modes grouped by cycle.
+var ft8CycleLengths = map[string]time.Duration{
+	"FT8": 15 * time.Second,
+	"FT4": 7500 * time.Millisecond,
+}
+
+var ft8CSVHeader = []string{"received", "cycle", "mode", "snr", "dt", "frequency", "message"}
+
+// ft8Output is the -ft8-csv file, if any.
+var ft8Output *eventCSVWriter
+
+// ft8Decode is a message decoded in an FT8 or FT4 cycle.
+type ft8Decode struct {
+	Received  time.Time `json:"received"`
+	SNR       float64   `json:"snr"`
+	DT        float64   `json:"dt"`
+	Frequency int64     `json:"frequency"`
+	Message   string    `json:"message"`
+}
+
+// ft8Cycle is everything decoded in one cycle of a mode.
+type ft8Cycle struct {
+	Mode    string      `json:"mode"`
+	Cycle   time.Time   `json:"cycle"`
+	Decodes []ft8Decode `json:"decodes"`
+}
+
+var (
+	ft8Mu      sync.Mutex
+	ft8Pending *ft8Cycle
+	ft8Timer   *time.Timer
+)
+
+// handleFT8 adds a decode to its cycle, which is logged as a whole once
+// ft8Wait has passed or a decode of another cycle arrives.
+func handleFT8(d owrx.WsjtDecode, received time.Time) {
+	message := strings.TrimSpace(d.Message)
+	if message == "" {
+		return
+	}
+	mode := strings.ToUpper(d.Mode)
+	cycle := ft8CycleStart(mode, d, received)
+
+	ft8Mu.Lock()
+	defer ft8Mu.Unlock()
+
+	if ft8Pending != nil && (ft8Pending.Mode != mode || !ft8Pending.Cycle.Equal(cycle)) {
+		flushFT8Locked()
+	}
+	if ft8Pending == nil {
+		ft8Pending = &ft8Cycle{Mode: mode, Cycle: cycle}
+		ft8Timer = time.AfterFunc(ft8Wait, flushFT8)
+	}
+	ft8Pending.Decodes = append(ft8Pending.Decodes, ft8Decode{
+		Received:  received,
+		SNR:       d.DB,
+		DT:        d.DT,
+		Frequency: d.Frequency,
+		Message:   message,
+	})
+}
+
+// ft8CycleStart returns the start of the cycle a decode belongs to. The
+// server's timestamp is rounded down to the cycle, as is the reception time
+// when there is none, less a cycle as decodes come after their cycle ends.
+func ft8CycleStart(mode string, d owrx.WsjtDecode, received time.Time) time.Time {
+	length := ft8CycleLengths[mode]
+	if d.Timestamp != 0 {
+		return wsjtCycle(d).Truncate(length)
+	}
+	return received.Add(-length).Truncate(length)
+}
+
+func flushFT8() {
+	ft8Mu.Lock()
+	defer ft8Mu.Unlock()
+
+	flushFT8Locked()
+}
+
+func flushFT8Locked() {
+	if ft8Timer != nil {
+		ft8Timer.Stop()
+		ft8Timer = nil
+	}
+	c := ft8Pending
+	ft8Pending = nil
+	if c == nil {
+		return
+	}
+
+	infof("%s %s: %d decoded", c.Mode, c.Cycle.UTC().Format("15:04:05.0"), len(c.Decodes))
+	for _, d := range c.Decodes {
+		infof("  %s", d)
+	}
+	dumpEvent(strings.ToLower(c.Mode), c)
+	recordDecoded(strings.ToLower(c.Mode), c)
+	if ft8Output != nil {
+		for _, d := range c.Decodes {
+			ft8Output.write(c.row(d))
+		}
+	}
+}
+
+func (d ft8Decode) String() string {
+	return fmt.Sprintf("%+4.0f dB %+5.1f s %.6f MHz  %s", d.SNR, d.DT, float64(d.Frequency)/1e6, d.Message)
+}
+
+func (c *ft8Cycle) row(d ft8Decode) []string {
+	return []string{
+		d.Received.Format(time.RFC3339Nano),
+		c.Cycle.UTC().Format("2006-01-02T15:04:05.0Z07:00"),
+		c.Mode,
+		strconv.FormatFloat(d.SNR, 'g', -1, 64),
+		strconv.FormatFloat(d.DT, 'g', -1, 64),
+		strconv.FormatInt(d.Frequency, 10),
+		d.Message,
+	}
+}
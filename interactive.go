@@ -0,0 +1,481 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+const (
+	minTuneStep = 1
+	maxTuneStep = 1000000
+
+	// OpenWebRX treats a squelch level of -150 dB as open.
+	minSquelch = -150
+	maxSquelch = 0
+)
+
+// tuneSteps are the steps up/down go through: the powers of ten and the
+// usual channel spacings between them.
+var tuneSteps = []int{1, 10, 100, 1000, 5000, 6250, 10000, 12500, 25000, 100000, 1000000}
+
+// interactiveKeys sums up the keys for the help line.
+const interactiveKeys = "left/right tune by the step, up/down change the step, g snap to the step, type an offset and Enter to jump, m/M change the mode, t the DMR timeslot, p/P the profile, [/] lower/raise the squelch by 1 dB, {/} by 10 dB, a the AGC, (/) the gain, n noise reduction, </> its level, u mute, s store a memory channel, a number and r recall it, r the next, l list them, e name and x delete the tuned one or a numbered one"
+
+// console is the interactive tuner: it reads keys from the terminal, applies
+// them to the DSP state and keeps a status line below the log on stderr.
+type console struct {
+	mu     sync.Mutex
+	out    *os.File
+	step   int
+	snap   bool
+	entry  []byte
+	smeter float64
+	seen   bool
+
+	// naming is set while a name is typed for memory channel nameFor,
+	// when every key but Enter, Esc and Backspace goes into the entry.
+	naming  bool
+	nameFor int
+
+	// screen is the -tui dashboard, which draws the status in place of
+	// the status line.
+	screen *dashboard
+}
+
+// validateInteractive checks there is a terminal for -interactive and
+// -tui before any output is set up, as startInteractive comes last.
+func validateInteractive() {
+	if !*interactive && !*tui {
+		return
+	}
+	if !terminalSupported {
+		fatalf("-interactive and -tui aren't supported on %s", runtime.GOOS)
+	}
+	if !isTerminal(os.Stdin.Fd()) {
+		fatalf("-interactive and -tui need a terminal on stdin")
+	}
+}
+
+// startInteractive puts the terminal in raw mode and starts reading keys
+// when -interactive or -tui is set. The returned function restores the
+// terminal.
+func startInteractive() (stop func()) {
+	if !*interactive && !*tui {
+		return func() {}
+	}
+
+	restore, err := makeRaw(os.Stdin.Fd())
+	if err != nil {
+		errorf("-interactive and -tui need a terminal on stdin: %v", err)
+		return func() {}
+	}
+
+	c := &console{
+		out:  os.Stderr,
+		step: int(*tuneStep),
+		snap: *snapToStep,
+	}
+	if *tui {
+		c.screen = newDashboard(os.Stderr, c)
+		log.SetOutput(c.screen)
+		go c.readKeys()
+		return func() {
+			log.SetOutput(os.Stderr)
+			c.screen.close()
+			restore()
+		}
+	}
+	log.SetOutput(c)
+	infof("Interactive: %s", interactiveKeys)
+
+	addSmeterHandler(c.handleSmeter)
+
+	go c.readKeys()
+
+	return func() {
+		log.SetOutput(os.Stderr)
+
+		c.mu.Lock()
+		fmt.Fprint(c.out, "\r\x1b[K")
+		c.mu.Unlock()
+
+		restore()
+	}
+}
+
+// Write prints a log line above the status line.
+func (c *console) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprint(c.out, "\r\x1b[K")
+	n, err := c.out.Write(p)
+	c.drawLocked()
+	return n, err
+}
+
+func (c *console) readKeys() {
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		c.handleInput(buf[:n])
+	}
+}
+
+func (c *console) handleInput(input []byte) {
+	for len(input) > 0 {
+		var action func()
+
+		c.mu.Lock()
+		arrow := len(input) >= 3 && input[0] == 0x1b && input[1] == '['
+		switch {
+		case c.naming && arrow:
+			// Arrows don't edit names, and their escape must not end one.
+			input = input[3:]
+		case c.naming:
+			action = c.handleNameKey(input[0])
+			input = input[1:]
+		case arrow:
+			action = c.handleArrow(input[2])
+			input = input[3:]
+		default:
+			action = c.handleKey(input[0])
+			input = input[1:]
+		}
+		c.mu.Unlock()
+
+		// Actions may log a send error, so they run without holding c.mu.
+		if action != nil {
+			action()
+		}
+	}
+
+	c.mu.Lock()
+	c.drawLocked()
+	c.mu.Unlock()
+}
+
+// handleArrow handles an arrow key and returns the change it asks for, if
+// any.
+func (c *console) handleArrow(key byte) func() {
+	step, snap := c.step, c.snap
+	switch key {
+	case 'C':
+		return func() { tuneStepped(step, 1, snap) }
+	case 'D':
+		return func() { tuneStepped(step, -1, snap) }
+	case 'A':
+		c.step = nextTuneStep(c.step, 1)
+	case 'B':
+		c.step = nextTuneStep(c.step, -1)
+	}
+	return nil
+}
+
+// nextTuneStep is the step of tuneSteps after step in dir, so a -step off
+// the list joins it at the nearest one.
+func nextTuneStep(step, dir int) int {
+	if dir > 0 {
+		for _, s := range tuneSteps {
+			if s > step {
+				return s
+			}
+		}
+		return step
+	}
+	for i := len(tuneSteps) - 1; i >= 0; i-- {
+		if tuneSteps[i] < step {
+			return tuneSteps[i]
+		}
+	}
+	return step
+}
+
+// tuneStepped tunes one step in dir. With snap it moves to the next
+// frequency on the step's grid instead, counted in real Hz once the
+// profile's center frequency is known, so 12.5 kHz steps land on the
+// channels from anywhere.
+func tuneStepped(step, dir int, snap bool) {
+	center := int(currentReceiver().CenterFreq)
+	retune(func(offset int) int {
+		if !snap {
+			return offset + dir*step
+		}
+		freq := center + offset
+		grid := freq - ((freq%step)+step)%step
+		switch {
+		case dir > 0:
+			grid += step
+		case grid == freq:
+			grid -= step
+		}
+		return grid - center
+	})
+}
+
+// handleKey edits the offset being typed and returns the change a key asks
+// for, if any.
+func (c *console) handleKey(key byte) func() {
+	switch {
+	case key >= '0' && key <= '9', key == '-' && len(c.entry) == 0:
+		c.entry = append(c.entry, key)
+	case key == 0x7f || key == '\b':
+		if len(c.entry) > 0 {
+			c.entry = c.entry[:len(c.entry)-1]
+		}
+	case key == 0x1b:
+		c.entry = nil
+	case key == '[' || key == ']' || key == '{' || key == '}':
+		delta := map[byte]int{'[': -1, ']': 1, '{': -10, '}': 10}[key]
+		return func() { adjustSquelch(delta) }
+	case key == 'p' || key == 'P':
+		dir := 1
+		if key == 'P' {
+			dir = -1
+		}
+		return func() { switchProfile(dir) }
+	case key == 't':
+		return cycleDMRFilter
+	case key == 'n':
+		return toggleNR
+	case key == 'a':
+		return cycleAGC
+	case key == 'u':
+		return toggleMute
+	case key == 'g':
+		c.snap = !c.snap
+	case key == 's':
+		return storeMemory
+	case key == 'l':
+		return logMemories
+	case key == 'e':
+		entry := string(c.entry)
+		c.entry = nil
+		return func() { c.startNaming(entry) }
+	case key == 'x':
+		entry := string(c.entry)
+		c.entry = nil
+		return func() {
+			if i, err := memoryAt(entry); err != nil {
+				errorf("%v", err)
+			} else {
+				deleteMemory(i)
+			}
+		}
+	case key == 'r':
+		entry := string(c.entry)
+		c.entry = nil
+		if entry == "" {
+			return recallNextMemory
+		}
+		if n, err := strconv.Atoi(entry); err == nil {
+			return func() { recallMemory(n - 1) }
+		}
+	case key == '(' || key == ')':
+		delta := map[byte]float64{'(': -1, ')': 1}[key]
+		return func() { adjustGain(delta) }
+	case key == '<' || key == '>':
+		delta := map[byte]int{'<': -1, '>': 1}[key]
+		return func() { adjustNR(delta) }
+	case key == 'm' || key == 'M':
+		dir := 1
+		if key == 'M' {
+			dir = -1
+		}
+		return func() { switchMode(dir) }
+	case key == '\r' || key == '\n':
+		offset, err := strconv.Atoi(string(c.entry))
+		c.entry = nil
+		if err == nil {
+			return func() { retune(func(int) int { return offset }) }
+		}
+	}
+	return nil
+}
+
+// startNaming starts typing a name for the memory channel numbered key, or
+// the one at the tuned frequency, beginning with the name it has.
+func (c *console) startNaming(key string) {
+	i, err := memoryAt(key)
+	if err != nil {
+		errorf("%v", err)
+		return
+	}
+	name := memoryName(i)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.naming, c.nameFor, c.entry = true, i, []byte(name)
+}
+
+// handleNameKey edits the name being typed, and on Enter returns giving it
+// to the channel.
+func (c *console) handleNameKey(key byte) func() {
+	switch key {
+	case '\r', '\n':
+		i, name := c.nameFor, string(c.entry)
+		c.naming, c.entry = false, nil
+		return func() { nameMemory(i, name) }
+	case 0x1b:
+		c.naming, c.entry = false, nil
+	case 0x7f, '\b':
+		if len(c.entry) > 0 {
+			_, size := utf8.DecodeLastRune(c.entry)
+			c.entry = c.entry[:len(c.entry)-size]
+		}
+	default:
+		if key >= ' ' {
+			c.entry = append(c.entry, key)
+		}
+	}
+	return nil
+}
+
+func validateTuneStep() {
+	if step := int(*tuneStep); step < minTuneStep || step > maxTuneStep {
+		fatalf("-step must be from %d Hz to %s", minTuneStep, formatStep(maxTuneStep))
+	}
+}
+
+// formatStep shows a step in the largest unit it is a whole or decimal
+// number of, e.g. 12.5 kHz.
+func formatStep(hz int) string {
+	switch {
+	case hz >= 1000000:
+		return strconv.FormatFloat(float64(hz)/1e6, 'f', -1, 64) + " MHz"
+	case hz >= 1000:
+		return strconv.FormatFloat(float64(hz)/1e3, 'f', -1, 64) + " kHz"
+	}
+	return strconv.Itoa(hz) + " Hz"
+}
+
+// retune moves the offset, keeping it within the band the receiver covers
+// when that is known.
+func retune(change func(offset int) int) {
+	limit := int(currentReceiver().SampleRate / 2)
+
+	updateDSP(func(s *owrx.DSP) {
+		s.OffsetFreq = change(s.OffsetFreq)
+		if limit > 0 {
+			s.OffsetFreq = clamp(s.OffsetFreq, -limit, limit)
+		}
+	})
+}
+
+func adjustSquelch(delta int) {
+	updateDSP(func(s *owrx.DSP) {
+		s.SquelchLevel = clamp(s.SquelchLevel+delta, minSquelch, maxSquelch)
+	})
+}
+
+// handleSmeter keeps the latest level next to the squelch in the status
+// line.
+func (c *console) handleSmeter(r smeterReading) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.smeter = smeterDB(r.Average)
+	c.seen = true
+	c.drawLocked()
+}
+
+// cycleDMRFilter steps the DMR timeslot filter through both slots, slot 1
+// and slot 2.
+func cycleDMRFilter() {
+	updateDSP(func(s *owrx.DSP) {
+		switch s.DMRFilter {
+		case owrx.DMRBothTimeslots:
+			s.DMRFilter = owrx.DMRTimeslot1
+		case owrx.DMRTimeslot1:
+			s.DMRFilter = owrx.DMRTimeslot2
+		default:
+			s.DMRFilter = owrx.DMRBothTimeslots
+		}
+	})
+}
+
+// switchMode moves to the next mode in dir, skipping those the server
+// can't run.
+func switchMode(dir int) {
+	updateDSP(func(s *owrx.DSP) {
+		next := owrx.NextMode(s.Mod, dir)
+		for checkModeSupport(next.Name) != nil && next.Name != s.Mod {
+			next = owrx.NextMode(next.Name, dir)
+		}
+		s.SetMode(next)
+	})
+}
+
+func (c *console) drawLocked() {
+	if c.screen != nil {
+		c.screen.refresh()
+		return
+	}
+
+	status := tuningStatus(currentDSP(), c.step, c.snap)
+	if c.seen {
+		status += "  level " + formatLevel(c.smeter)
+	}
+	if rtt := latencyStatus(); rtt != "" {
+		status += "  " + rtt
+	}
+	status += " " + c.promptLocked()
+
+	fmt.Fprint(c.out, "\r\x1b[K", status)
+}
+
+// promptLocked shows what is being typed: an offset, a channel number or a
+// memory channel's name.
+func (c *console) promptLocked() string {
+	if c.naming {
+		return fmt.Sprintf("name channel %d > %s", c.nameFor+1, c.entry)
+	}
+	return "> " + string(c.entry)
+}
+
+// tuningStatus describes the demodulator setup and tuning step for the
+// status line.
+func tuningStatus(s owrx.DSP, step int, snap bool) string {
+	status := strings.ToUpper(s.Mod)
+	if s.Mod == "dmr" {
+		status += " " + dmrSlots(s.DMRFilter)
+	}
+	status += " " + formatTuning(currentReceiver(), s.OffsetFreq)
+	status += "  step " + formatStep(step)
+	if snap {
+		status += " snap"
+	}
+	status += fmt.Sprintf("  sq %d dB", s.SquelchLevel)
+	if isMuted() {
+		status += "  muted"
+	}
+	if s.CTCSSTone != 0 {
+		status += fmt.Sprintf(" CTCSS %.1f Hz", s.CTCSSTone)
+	}
+	switch s.AGC {
+	case "":
+	case "off":
+		status += fmt.Sprintf("  AGC off %+g dB", s.Gain)
+	default:
+		status += "  AGC " + s.AGC
+	}
+	if s.NRAvailable && s.NoiseReduction {
+		status += fmt.Sprintf("  NR %d dB", s.NRThreshold)
+	}
+	if notch := notchStatus(s.AutoNotch, s.NotchFreqs); notch != "" {
+		status += "  " + notch
+	}
+	return status
+}
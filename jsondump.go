@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const jsonDumpQueue = 1024
+
+// binaryRecord describes a binary message in the -json dump.
+type binaryRecord struct {
+	Type    string `json:"type"`
+	Subtype int    `json:"subtype"`
+	Bytes   int    `json:"bytes"`
+}
+
+// textRecord wraps a text message that isn't JSON, such as the server's
+// handshake line.
+type textRecord struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// eventRecord carries something decoded from the messages, such as the
+// parsed bookmarks, alongside the messages themselves.
+type eventRecord struct {
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Time  time.Time   `json:"time"`
+	Value interface{} `json:"value"`
+}
+
+// jsonDumper writes one JSON line per received message on its own
+// goroutine, flushing whenever it catches up so the output can be piped.
+type jsonDumper struct {
+	out     io.WriteCloser
+	buf     *bufio.Writer
+	lines   chan []byte
+	done    chan struct{}
+	dropped int
+}
+
+var (
+	dumperMu sync.Mutex
+	dumper   *jsonDumper
+)
+
+func setupJSONDump() {
+	if *jsonDump == "" {
+		return
+	}
+
+	var out io.WriteCloser = os.Stdout
+	if *jsonDump == "-" {
+		if *raw || *waterfall {
+			fatalf("-json - can't share stdout with -raw or -waterfall")
+		}
+	} else {
+		file, err := os.Create(*jsonDump)
+		if err != nil {
+			fatalf("Failed to create %s: %v", *jsonDump, err)
+		}
+		out = file
+	}
+
+	dumper = &jsonDumper{
+		out:   out,
+		buf:   bufio.NewWriter(out),
+		lines: make(chan []byte, jsonDumpQueue),
+		done:  make(chan struct{}),
+	}
+	go dumper.run()
+}
+
+func closeJSONDump() {
+	dumperMu.Lock()
+	d := dumper
+	dumper = nil
+	dumperMu.Unlock()
+	if d == nil {
+		return
+	}
+
+	close(d.lines)
+	<-d.done
+	if d.dropped > 0 {
+		warnf("JSON dump: dropped %d messages", d.dropped)
+	}
+	if d.out != os.Stdout {
+		d.out.Close()
+	}
+}
+
+// dumpMessage queues a received message for the -json dump, if enabled.
+func dumpMessage(messageType int, message []byte) {
+	dumperMu.Lock()
+	defer dumperMu.Unlock()
+
+	d := dumper
+	if d == nil {
+		return
+	}
+
+	var line []byte
+	switch {
+	case messageType == websocket.BinaryMessage && len(message) > 0:
+		line, _ = json.Marshal(binaryRecord{Type: "binary", Subtype: int(message[0]), Bytes: len(message) - 1})
+	case messageType == websocket.TextMessage && json.Valid(message):
+		var compact bytes.Buffer
+		json.Compact(&compact, message)
+		line = compact.Bytes()
+	case messageType == websocket.TextMessage:
+		line, _ = json.Marshal(textRecord{Type: "text", Value: string(message)})
+	default:
+		return
+	}
+
+	d.queue(line)
+}
+
+// dumpEvent adds a decoded event to the -json dump, if enabled.
+func dumpEvent(event string, value interface{}) {
+	dumperMu.Lock()
+	defer dumperMu.Unlock()
+
+	if dumper == nil {
+		return
+	}
+	line, err := json.Marshal(eventRecord{Type: "event", Event: event, Time: time.Now(), Value: value})
+	if err != nil {
+		errorf("encoding %s event: %v", event, err)
+		return
+	}
+	dumper.queue(line)
+}
+
+func (d *jsonDumper) queue(line []byte) {
+	select {
+	case d.lines <- line:
+	default:
+		d.dropped++
+	}
+}
+
+func (d *jsonDumper) run() {
+	defer close(d.done)
+
+	for line := range d.lines {
+		d.buf.Write(line)
+		d.buf.WriteByte('\n')
+		if len(d.lines) == 0 {
+			if err := d.buf.Flush(); err != nil {
+				errorf("writing JSON dump: %v", err)
+			}
+		}
+	}
+	if err := d.buf.Flush(); err != nil {
+		errorf("writing JSON dump: %v", err)
+	}
+}
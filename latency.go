@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// slowControlLatency is the round trip above which a control message is
+// worth a warning: tuning that slow is felt.
+const slowControlLatency = 2 * time.Second
+
+// controlLatency follows the round trips of the control messages, for the
+// status line, the dashboard and the metrics.
+type controlLatency struct {
+	mu    sync.Mutex
+	last  time.Duration
+	sum   time.Duration
+	count uint64
+}
+
+var latency controlLatency
+
+func handleControlLatency(rtt time.Duration) {
+	latency.mu.Lock()
+	latency.last = rtt
+	latency.sum += rtt
+	latency.count++
+	latency.mu.Unlock()
+
+	if rtt > slowControlLatency {
+		warnf("The server took %v to take a control message", rtt.Round(time.Millisecond))
+	} else {
+		debugf("Control round trip: %.1f ms", float64(rtt.Microseconds())/1000)
+	}
+}
+
+// lastControlLatency returns the latest round trip, and false before the
+// first.
+func lastControlLatency() (time.Duration, bool) {
+	latency.mu.Lock()
+	defer latency.mu.Unlock()
+
+	return latency.last, latency.count > 0
+}
+
+// latencyStatus is the latest round trip for the status line and the
+// dashboard, empty before the first.
+func latencyStatus() string {
+	rtt, ok := lastControlLatency()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("rtt %d ms", rtt.Milliseconds())
+}
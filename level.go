@@ -0,0 +1,105 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// levelMeter tracks the post-demodulation audio level, as opposed to the
+// RF level reported by the server's smeter, and logs it periodically.
+type levelMeter struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	blocks []levelBlock
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type levelBlock struct {
+	at         time.Time
+	sumSquares float64
+	samples    int
+}
+
+func newLevelMeter(interval, window time.Duration) *levelMeter {
+	m := &levelMeter{
+		window: window,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go m.run(interval)
+	return m
+}
+
+func (m *levelMeter) WriteAudio(frame owrx.AudioFrame) error {
+	block := levelBlock{at: time.Now(), samples: len(frame.Samples)}
+	for _, s := range frame.Samples {
+		v := float64(s) / 32768
+		block.sumSquares += v * v
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.blocks = append(m.blocks, block)
+	m.expire(block.at)
+	return nil
+}
+
+func (m *levelMeter) expire(now time.Time) {
+	i := 0
+	for i < len(m.blocks) && now.Sub(m.blocks[i].at) > m.window {
+		i++
+	}
+	m.blocks = m.blocks[i:]
+}
+
+// level returns the RMS level over the averaging window in dBFS.
+func (m *levelMeter) level() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire(time.Now())
+
+	var sumSquares float64
+	var samples int
+	for _, b := range m.blocks {
+		sumSquares += b.sumSquares
+		samples += b.samples
+	}
+	return dBFS(sumSquares, samples)
+}
+
+func dBFS(sumSquares float64, samples int) float64 {
+	if samples == 0 || sumSquares == 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(math.Sqrt(sumSquares/float64(samples)))
+}
+
+func (m *levelMeter) run(interval time.Duration) {
+	defer close(m.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			infof("Audio level: %.1f dBFS", m.level())
+		}
+	}
+}
+
+func (m *levelMeter) Close() error {
+	close(m.stop)
+	<-m.done
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+	levelFatal
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error", "fatal"}
+
+// logPrefixes start the plain text form of each level's lines. Info and
+// fatal messages are printed as they are.
+var logPrefixes = []string{"Debug: ", "", "Warning: ", "Error: ", ""}
+
+var minLogLevel = levelInfo
+
+// logRecord is a line of -log-json output.
+type logRecord struct {
+	Time     string `json:"time"`
+	Level    string `json:"level"`
+	Receiver string `json:"receiver,omitempty"`
+	Message  string `json:"msg"`
+}
+
+func setupLogging() {
+	for i, name := range logLevelNames {
+		if strings.EqualFold(*logLevelName, name) && logLevel(i) != levelFatal {
+			minLogLevel = logLevel(i)
+			return
+		}
+	}
+	fatalf("Unknown -log-level %q, use debug, info, warn or error", *logLevelName)
+}
+
+func logf(level logLevel, format string, v ...interface{}) {
+	receiverLogf("", level, format, v...)
+}
+
+// receiverLogf logs a line about one of the receivers runReceivers runs,
+// prefixed with its label, or with -log-json in a receiver field.
+func receiverLogf(label string, level logLevel, format string, v ...interface{}) {
+	if level < minLogLevel {
+		return
+	}
+
+	msg := fmt.Sprintf(format, v...)
+	if !*logJSON {
+		if label != "" {
+			msg = "[" + label + "] " + msg
+		}
+		log.Print(logPrefixes[level] + msg)
+		return
+	}
+
+	line, _ := json.Marshal(logRecord{
+		Time:     time.Now().Format(time.RFC3339Nano),
+		Level:    logLevelNames[level],
+		Receiver: label,
+		Message:  msg,
+	})
+	log.Print(string(line))
+}
+
+func debugf(format string, v ...interface{}) { logf(levelDebug, format, v...) }
+func infof(format string, v ...interface{})  { logf(levelInfo, format, v...) }
+func warnf(format string, v ...interface{})  { logf(levelWarn, format, v...) }
+func errorf(format string, v ...interface{}) { logf(levelError, format, v...) }
+
+// fatalf logs at any level and exits, skipping deferred cleanup like
+// log.Fatalf.
+func fatalf(format string, v ...interface{}) {
+	logf(levelFatal, format, v...)
+	os.Exit(1)
+}
@@ -1,202 +1,418 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"flag"
 	"log"
-	"net/url"
 	"os"
 	"os/signal"
-	"strings"
+	"sync"
+	"syscall"
+	"time"
 
-	"github.com/gorilla/websocket"
+	"net.wadon/owrxp-playground/owrx"
 )
 
 var (
-	addr       = flag.String("addr", "localhost:8073", "openwebrx service address")
-	squelch    = flag.Int("sq", -120, "squech level")
-	freqOffset = flag.Int("offset", 0, "frequency offset")
+	addr             = flag.String("addr", "localhost:8073", "openwebrx service address, a wss:// or https:// prefix enables TLS")
+	configFile       = flag.String("config", "", "load settings from a JSON file keyed by flag name, flags on the command line take precedence")
+	profile          = flag.String("profile", "", "named profile from the -config file to use")
+	receiverName     = flag.String("receiver", "", "run only this entry of the -config file's receivers")
+	profileID        = flag.String("profile-id", "", "server SDR profile to select, as sdr|profile, e.g. rtlsdr|2m")
+	useTLS           = flag.Bool("tls", false, "connect with TLS (wss://)")
+	insecure         = flag.Bool("insecure", false, "skip TLS certificate verification")
+	wsPath           = flag.String("path", "/ws/", "WebSocket path on the server, e.g. /sdr/ws/ behind a reverse proxy")
+	user             = flag.String("user", "", "HTTP basic auth user name")
+	pass             = flag.String("pass", "", "HTTP basic auth password")
+	connectTimeout   = flag.Duration("connect-timeout", 10*time.Second, "timeout for connecting and the WebSocket handshake")
+	pingInterval     = flag.Duration("ping-interval", 30*time.Second, "interval between keepalive pings, 0 disables them")
+	pingTimeout      = flag.Duration("ping-timeout", 10*time.Second, "time to wait for a pong before the connection is considered dead")
+	squelch          = flag.Int("sq", -120, "squech level")
+	ctcss            = flag.Float64("ctcss", 0, "only open the squelch on transmissions with this CTCSS tone in Hz, e.g. 88.5, 0 disables")
+	noiseReduction   = flag.Bool("nr", false, "turn on noise reduction if the server supports it")
+	nrLevel          = flag.Int("nr-level", 10, "noise reduction threshold in dB for -nr, 0 to 20")
+	autoNotch        = flag.Bool("notch-auto", false, "have the server find and notch out steady carriers")
+	agc              = flag.String("agc", "", "AGC: fast, slow or off, leaves the server's setting by default")
+	gain             = flag.Float64("gain", 0, "fixed gain in dB with -agc off")
+	squelchHang      = flag.Duration("squelch-hang", 500*time.Millisecond, "time the squelch stays open after the signal drops")
+	squelchLog       = flag.Bool("squelch-log", false, "log squelch openings and closings, with a summary on exit")
+	freqOffset       = flag.Int("offset", 0, "frequency offset")
+	bookmarkName     = flag.String("bookmark", "", "tune to the server bookmark or digital mode dial frequency with this name")
+	memoryFile       = flag.String("memory", "", "memory channel file, in the -scan-list format, owrxp-playground/memory.csv in the user config directory by default")
+	recallName       = flag.String("recall", "", "tune to the memory channel with this name or number")
+	mod              = flag.String("mod", "nfm", "demodulation mode, e.g. nfm, am, usb, lsb, cw or dmr")
+	secondary        = flag.String("secondary", "", "run the secondary demodulator for a digital mode such as ft8, wspr, packet or pocsag")
+	lowCut           = flag.Int("lowcut", 0, "lower edge of the filter passband in Hz relative to the offset, defaults to the -mod passband")
+	highCut          = flag.Int("highcut", 0, "upper edge of the filter passband in Hz relative to the offset, defaults to the -mod passband")
+	dmrFilterName    = flag.String("dmr-filter", "both", "DMR timeslot filter: both (or all), ts1 or ts2, or the bitmask 1 to 3")
+	interactive      = flag.Bool("interactive", false, "tune with the keyboard while running")
+	tui              = flag.Bool("tui", false, "show a live dashboard in the terminal, with the -interactive keys")
+	snapToStep       = flag.Bool("snap", false, "have -interactive tuning snap the frequency to the step grid")
+	dwellTime        = flag.Duration("dwell", 500*time.Millisecond, "time to listen on each scan channel while searching")
+	holdTime         = flag.Duration("hold", 2*time.Second, "time to stay on a scan channel after its squelch closes")
+	priorityEvery    = flag.Duration("priority-interval", 2*time.Second, "time between checks of the -priority channel")
+	scanList         = flag.String("scan-list", "", "scan the channels in this CSV file of frequency,mode,squelch,name instead of a range")
+	reconnect        = flag.Bool("reconnect", true, "reconnect when the connection drops")
+	reconnectMax     = flag.Int("reconnect-max", 0, "give up and exit with an error after this many reconnect attempts, 0 for no limit")
+	dryRun           = flag.Bool("dry-run", false, "connect and log the messages that would be sent, sending only the handshake")
+	sdrErrorAction   = flag.String("sdr-error", "log", "what to do when the server reports a device error: log, reconnect or next-profile")
+	backoffBase      = flag.Duration("backoff-base", time.Second, "initial reconnect delay, doubled after every failed attempt")
+	backoffMax       = flag.Duration("backoff-max", time.Minute, "maximum reconnect delay")
+	output           = flag.String("o", "", "write audio to a WAV file, the name may contain strftime-style tokens such as %Y%m%d_%H%M%S")
+	vox              = flag.Bool("vox", false, "only record while the squelch is open, one -o file per opening")
+	rotateDuration   = flag.Duration("rotate-duration", 0, "start a new recording file after this much audio")
+	sidecar          = flag.Bool("sidecar", false, "write a JSON file describing each recording next to it")
+	recordSignal     = flag.Bool("record-signal", false, "start and stop recording on SIGUSR1, to -o or a timestamped file")
+	rotateSize       = new(byteSize)
+	tuneFreq         = new(frequency)
+	scanStart        = new(frequency)
+	scanStop         = new(frequency)
+	scanStep         = newFrequency(12500)
+	tuneStep         = newFrequency(1000)
+	priorityFreq     = new(frequency)
+	raw              = flag.Bool("raw", false, "write raw s16le PCM audio to stdout")
+	startMuted       = flag.Bool("mute", false, "start with the audio muted, see the u key and POST /unmute")
+	play             = flag.Bool("play", false, "play audio on the local sound device")
+	playCmd          = flag.String("play-cmd", defaultPlayCommand, "playback command reading s16le PCM on stdin, {rate} is replaced with the sample rate")
+	playLatency      = flag.Duration("play-latency", 200*time.Millisecond, "playback buffer target latency")
+	outputRate       = flag.Int("rate", 11025, "audio output rate")
+	hdOutputRate     = flag.Int("hdrate", 44100, "HD audio output rate")
+	bufferMs         = flag.Int("buffer-ms", 2000, "audio buffer capacity in milliseconds")
+	drainTimeout     = flag.Duration("drain-timeout", 2*time.Second, "on exit, how long to wait for buffered audio to reach the outputs")
+	audioStats       = flag.Duration("audio-stats", 0, "log audio buffer fill, underruns, overruns and latency at this interval, 0 disables")
+	level            = flag.Duration("level", 0, "log the audio level in dBFS at this interval, 0 disables")
+	levelWindow      = flag.Duration("level-window", time.Second, "averaging window for -level")
+	resample         = flag.Int("resample", 0, "resample audio to this rate before output, 0 keeps the server rate")
+	fftCSV           = flag.String("fft-csv", "", "write FFT frames to a CSV file")
+	fftRecord        = flag.String("fft-record", "", "write FFT frames to a compact binary file, see the README for the format")
+	replaySpeed      = flag.Float64("speed", 1, "-replay speed, 2 plays twice as fast, 0 as fast as possible")
+	jsonDump         = flag.String("json", "", "write every received message as a JSON line to this file, - for stdout")
+	metricsAddr      = flag.String("metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9100")
+	apiAddr          = flag.String("api-addr", "", "serve the HTTP control API on this address, e.g. localhost:8080")
+	recordDir        = flag.String("record-dir", "", "directory of recordings named in POST /recording/start, default the current one")
+	logLevelName     = flag.String("log-level", "info", "log messages at this level and above: debug, info, warn or error")
+	logJSON          = flag.Bool("log-json", false, "log JSON lines instead of plain text")
+	smeterCSV        = flag.String("smeter-csv", "", "append smeter readings to a CSV file")
+	smeterWindow     = flag.Duration("smeter-window", 0, "average the smeter over this window for the squelch, alerts and display, 0 disables")
+	smeterCal        = flag.Float64("smeter-cal", 0, "dB to add to the smeter level for dBm at the antenna input, found with a known signal")
+	smeterHistLog    = flag.Bool("smeter-histogram", false, "log a histogram of the smeter levels and the noise floor on exit")
+	smeterHistCSV    = flag.String("smeter-histogram-csv", "", "write the smeter histogram to a CSV file on exit")
+	wsprCSV          = flag.String("wspr-csv", "", "append WSPR spots to a CSV file")
+	ft8CSV           = flag.String("ft8-csv", "", "append FT8 and FT4 decodes to a CSV file")
+	capcodes         = flag.String("capcode", "", "only log POCSAG messages to these capcodes, separated by commas")
+	alertLevel       = flag.Float64("alert-level", 0, "log an alert when the smeter rises above this level in dB")
+	alertHold        = flag.Duration("alert-hold", 5*time.Second, "time the level must stay below -alert-level before the alert clears")
+	alertWebhook     = flag.String("alert-webhook", "", "URL to POST -alert-level events to as JSON")
+	waterfall        = flag.Bool("waterfall", false, "draw an ANSI waterfall of the FFT on stdout")
+	waterfallPNGFile = flag.String("waterfall-png", "", "write the FFT as a waterfall PNG image on exit, the name may contain strftime-style tokens")
+	paletteName      = flag.String("palette", "classic", "waterfall colors: classic, viridis, turbo or grayscale")
+	waterfallDB      = flag.String("waterfall-range", "auto", "waterfall dB range: auto from the noise floor and peaks, server for the operator's, or min:max, e.g. -120:-20")
+	peaks            = flag.Bool("peaks", false, "log signals standing out from the noise floor in the FFT")
+	peakThreshold    = flag.Float64("peak-threshold", 10, "dB above the noise floor for -peaks")
+	peakSeparation   = flag.Int("peak-separation", 10000, "minimum distance between -peaks in Hz")
 )
 
+var extraHeaders headerFlags
+
+// client is the connection to the server, set up from the flags.
+var client *owrx.Client
+
+func init() {
+	flag.Var(&notchFreqs, "notch", "audio frequency in Hz to notch out, e.g. 1000, separated by commas or repeated")
+	flag.Var(&extraHeaders, "header", "extra HTTP header for the WebSocket handshake as key=value, may be repeated")
+	flag.Var(tuneFreq, "freq", "frequency to tune to, e.g. 145.5M, the offset is computed from the profile's center frequency")
+	flag.Var(scanStart, "scan-start", "scan channels from this frequency, e.g. 144.8M")
+	flag.Var(scanStop, "scan-stop", "last frequency to scan")
+	flag.Var(scanStep, "scan-step", "channel spacing for the scan")
+	flag.Var(tuneStep, "step", "initial -interactive tuning step, e.g. 12.5k")
+	flag.Var(priorityFreq, "priority", "priority channel to check every -priority-interval while scanning, e.g. 145.5M")
+	flag.Var(rotateSize, "rotate-size", "start a new recording file once it reaches this size, e.g. 100M")
+	flag.Var(&replayFiles, "replay", "play an -fft-record file, WAV recording or -json dump instead of connecting, may be repeated")
+	flag.Var(&fftRate, "fft-rate", "pass at most this many FFT frames per second to the FFT outputs, or 1/N for one of every N")
+}
+
+// exitStatus is what the process exits with once main has cleaned up,
+// which fatalf would skip.
+var exitStatus int
+
 func main() {
+	defer func() {
+		if exitStatus != 0 {
+			os.Exit(exitStatus)
+		}
+	}()
+
 	flag.Parse()
 	log.SetFlags(0)
+	log.SetOutput(os.Stderr)
 
-	interrupt := setupInterruptHandler()
+	loadConfig()
+	setupLogging()
+	if len(receiverLabels) > 0 {
+		runReceivers()
+		return
+	}
 
-	conn, done := connectToWebSocket()
-	defer conn.Close()
+	validateOutputRates()
+	validatePath()
+	validateSecondary()
+	validateCapcodes()
+	validateMode()
+	validateCuts()
+	validateDMRFilter()
+	validateCTCSS()
+	validateNR()
+	validateAGC()
+	validateFrequency()
+	validateTuneStep()
+	validateScan()
+	validateWaterfall()
+	validateBookmark()
+	validateMemory()
+	validateSDRErrorAction()
+	validateSmeterCal()
+	validateReplay()
+	validateInteractive()
+	validateRecordDir()
 
-	go handleMessages(conn, done)
+	setupClient()
+	setMuted(*startMuted)
 
-	initializeConnection(conn)
+	ctx, stop := setupInterruptHandler()
+	defer stop()
 
-  startAudio(conn)
+	setupAudioOutputs()
+	defer closeAudioSinks()
 
-	mainLoop(conn, interrupt, done)
-}
+	setupRecordSignal()
+	defer closeRecordSignal()
 
-func setupInterruptHandler() chan os.Signal {
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt)
-	return interrupt
-}
+	setupFFTOutputs()
+	defer closeFFTOutputs()
 
-func connectToWebSocket() (*websocket.Conn, chan struct{}) {
-	u := url.URL{Scheme: "ws", Host: *addr, Path: "/ws/"}
-	log.Printf("Connecting to %s", u.String())
+	setupJSONDump()
+	defer closeJSONDump()
 
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
-	if err != nil {
-		log.Fatalf("Failed to connect: %v", err)
-	}
+	setupMetrics()
+	defer closeMetrics()
 
-	done := make(chan struct{})
-	return conn, done
-}
+	setupAPI()
+	defer closeAPI()
 
-func handleMessages(conn *websocket.Conn, done chan struct{}) {
-	defer close(done)
+	setupSmeterOutputs()
+	defer closeSmeterOutputs()
 
-	for {
-		messageType, message, err := conn.ReadMessage()
-		if err != nil {
-			log.Printf("Error reading message: %v", err)
-			return
-		}
+	setupSmeterHistogram()
+	defer closeSmeterHistogram()
 
-		switch messageType {
-		case websocket.BinaryMessage:
-			handleBinaryMessage(message)
-		case websocket.TextMessage:
-			handleTextMessage(message)
-		default:
-			log.Println("Received unknown message type")
-		}
-	}
-}
+	setupDecoderOutputs()
+	defer closeDecoderOutputs()
 
-func handleBinaryMessage(message []byte) {
-	if len(message) == 0 {
-		return
-	}
+	setupAlerts()
 
-	firstByte := message[0]
-	// data := message[1:]
+	setupSquelchEvents()
+	defer closeSquelchEvents()
 
-	switch firstByte {
-	case 1:
-		// Handle FFT
-	case 2:
-		log.Println("Audio data received")
-	case 4:
-		log.Println("HD audio data received")
-	default:
-		log.Println("Unhandled binary message type")
-	}
-}
+	setupScanner()
+	defer closeScanner()
+
+	// The terminal goes raw only once nothing above can fail with fatalf,
+	// which would exit without restoring it.
+	stopInteractive := startInteractive()
+	defer stopInteractive()
 
-func handleTextMessage(message []byte) {
-	var msgData map[string]interface{}
-	err := json.Unmarshal(message, &msgData)
-	if err != nil {
-		handleTextParsingError(message, err)
+	if len(replayFiles) > 0 {
+		runReplay(ctx)
 		return
 	}
 
-	if msgType, ok := msgData["type"].(string); ok && msgType == "smeter" {
-		if value, ok := msgData["value"]; ok {
-			log.Printf("Smeter [absolute]: %v", value)
-		}
+	err := client.Run(ctx)
+	switch state := clientState(); {
+	case ctx.Err() != nil && state == owrx.StateConnecting:
+		infof("Interrupt received, not connecting")
+	case ctx.Err() != nil && state == owrx.StateWaiting:
+		infof("Interrupt received, not reconnecting")
+	case err != nil && !*reconnect:
+		// Not fatalf, so the terminal and the outputs are cleaned up.
+		errorf("Failed to connect: %v", err)
+		exitStatus = 1
+	case errors.Is(err, owrx.ErrReconnectLimit):
+		// The outputs are still closed properly on the way out.
+		errorf("Giving up: %v", err)
+		exitStatus = 1
+	case err != nil:
+		warnf("%v", err)
 	}
 }
 
-func handleTextParsingError(message []byte, err error) {
-	if strings.HasPrefix(string(message), "CLIENT DE SERVER") {
-		log.Println(string(message))
-	} else {
-		log.Printf("Error parsing text message: %v", err)
-		log.Printf("Raw message: %s", string(message))
-	}
+// setupInterruptHandler returns the root context of the process, cancelled
+// when the user interrupts it or, as systemd and docker stop a service, on
+// SIGTERM, so the outputs are finalized either way.
+func setupInterruptHandler() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 }
 
-func initializeConnection(conn *websocket.Conn) {
-	sendMessage(conn, "SERVER DE CLIENT client=openwebrx.js type=receiver")
-
-	sendMessage(conn, map[string]interface{}{
-		"params": map[string]interface{}{
-			"hd_output_rate": 44100,
-			"output_rate":    11025,
-		},
-		"type": "connectionproperties",
-	})
+// setupClient creates the client from the flags and wires its messages
+// to the outputs.
+func setupClient() {
+	_, host := serverScheme()
+	client = owrx.NewClient(host, clientOptions()...)
+	if *profileID != "" {
+		useProfile(*profileID)
+	}
 
-	sendMessage(conn, map[string]interface{}{
-		"params": map[string]interface{}{
-			"audio_service_id": 0,
-			"dmr_filter":       3,
-			"high_cut":         4000,
-			"low_cut":          -4000,
-			"mod":              "nfm",
-			"offset_freq":      *freqOffset,
-			"secondary_mod":    false,
-			"squelch_level":    *squelch,
-		},
-		"type": "dspcontrol",
+	client.OnStatus(handleStatus)
+	client.OnRaw(handleRawMessage)
+	client.OnMessage(handleTextMessage)
+	client.OnText(handleTextParsingError)
+	client.OnSend(logSentMessage)
+	client.OnControlLatency(handleControlLatency)
+	client.OnSmeter(handleSmeter)
+	if *secondary != "" {
+		client.OnSecondaryFFT(handleSecondaryFFT)
+	}
+	client.OnError(func(err error) {
+		errorf("%v", err)
 	})
 }
 
-func startAudio(conn *websocket.Conn) {
-	sendMessage(conn, map[string]interface{}{
-		"type":   "dspcontrol",
-		"action": "start",
-	})
+// lastState is the last state the client reported, for telling where an
+// interrupt stopped it. StateAudioStarted comes from the connection's
+// reader and the others from Run, hence the lock.
+var (
+	lastStateMu sync.Mutex
+	lastState   owrx.State
+)
+
+func clientState() owrx.State {
+	lastStateMu.Lock()
+	defer lastStateMu.Unlock()
+
+	return lastState
 }
 
-func sendMessage(conn *websocket.Conn, message interface{}) {
-	var msg []byte
-	var err error
-
-	switch m := message.(type) {
-	case string:
-		msg = []byte(m)
-	case map[string]interface{}:
-		msg, err = json.Marshal(m)
-		if err != nil {
-			log.Printf("Error marshalling JSON: %v", err)
-			return
+// handleStatus logs the connections the client makes.
+func handleStatus(status owrx.Status) {
+	lastStateMu.Lock()
+	lastState = status.State
+	lastStateMu.Unlock()
+
+	switch status.State {
+	case owrx.StateConnecting:
+		infof("Connecting to %s", client.URL())
+		resetAudio()
+		resetNR()
+	case owrx.StateConnectFailed:
+		if *reconnect {
+			errorf("failed to connect: %v", status.Err)
+		}
+	case owrx.StateConnected:
+		setConnected(true)
+	case owrx.StateDisconnected:
+		setConnected(false)
+		logReadError(status.Err)
+		infof("Connection closed")
+	case owrx.StateWaiting:
+		infof("Reconnecting in %v (attempt %d)", status.Delay, status.Attempt)
+		countReconnect()
+	case owrx.StateClosing:
+		setConnected(false)
+		infof("Interrupt received, closing connection")
+	case owrx.StateAudioStarted:
+		if status.Held > 0 {
+			infof("Audio started, %d frames buffered before the outputs were ready", status.Held)
+		} else {
+			debugf("Audio started")
 		}
 	}
+}
 
-	err = conn.WriteMessage(websocket.TextMessage, msg)
-	if err != nil {
-		log.Printf("Error sending message: %v", err)
+// logSentMessage shows what goes to the server: with -dry-run everything,
+// marking what was held back, and otherwise at debug level.
+func logSentMessage(message []byte, sent bool) {
+	switch {
+	case !sent:
+		infof("Dry run, not sent: %s", message)
+	case *dryRun:
+		infof("Sent: %s", message)
+	default:
+		debugf("Sent: %s", message)
 	}
 }
 
-func mainLoop(conn *websocket.Conn, interrupt chan os.Signal, done chan struct{}) {
-	for {
-		select {
-		case <-done:
-			log.Println("Connection closed")
-			return
-		case <-interrupt:
-			log.Println("Interrupt received, closing connection")
-			closeConnection(conn, done, interrupt)
-			return
+func handleRawMessage(messageType int, message []byte) {
+	dumpMessage(messageType, message)
+	countRawMessage(messageType, message)
+}
+
+func handleTextMessage(msg owrx.Message) {
+	switch m := msg.(type) {
+	case *owrx.HandshakeMessage:
+		handleHandshake(m)
+	case *owrx.ConfigMessage:
+		handleConfig(m.Value)
+	case *owrx.ProfilesMessage:
+		handleProfiles(m.Value)
+	case *owrx.BookmarksMessage:
+		handleBookmarks(m.Type(), serverBookmarkList(m.Value))
+	case *owrx.DialFrequenciesMessage:
+		handleBookmarks(m.Type(), dialFrequencyList(m.Value))
+	case *owrx.SecondaryConfigMessage:
+		handleSecondaryConfig(m.Value)
+	case *owrx.SecondaryDemodMessage:
+		handleSecondaryText(m.Value)
+	case *owrx.ReceiverDetailsMessage:
+		handleReceiverDetails(m.Value)
+	case *owrx.BackoffMessage:
+		logBackoff(m)
+	case *owrx.SDRErrorMessage:
+		handleSDRError(m.Value)
+	case *owrx.DemodulatorErrorMessage:
+		handleDemodulatorError(m.Value)
+	case *owrx.MetadataMessage:
+		handleMetadata(m.Value)
+	case *owrx.FeaturesMessage:
+		handleFeatures(m.Value)
+	case *owrx.ModesMessage:
+		checkServerModes(m.Value)
+	case *owrx.AprsDataMessage:
+		handleAprs(m.Value)
+	case *owrx.WsjtMessage:
+		handleWsjt(m.Value)
+	case *owrx.PocsagMessage:
+		handlePocsag(m.Value)
+	case *owrx.UnknownMessage:
+		if secondaryDataTypes[m.MsgType] {
+			handleSecondaryData(m.MsgType, m.Value)
 		}
 	}
 }
 
-func closeConnection(conn *websocket.Conn, done chan struct{}, interrupt chan os.Signal) {
-	err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-	if err != nil {
-		log.Printf("Error during close: %v", err)
-		return
+func handleConfig(config owrx.Config) {
+	before := currentReceiver()
+	updateReceiver(config)
+	after := currentReceiver()
+	logProfileChange(before, after)
+
+	// A new center frequency moves the tuned frequency along with it,
+	// unless -freq or -recall retune, which logs the frequency anyway.
+	offset := currentDSP().OffsetFreq
+	tuneToFrequency(before, after)
+	applyRecall(after)
+	if after.CenterFreq != before.CenterFreq && currentDSP().OffsetFreq == offset {
+		logTuning(after, offset)
 	}
 
-	select {
-	case <-done:
-	case <-interrupt:
+	if config.AudioCompression != nil {
+		logCompression("Audio", &audioCompression, *config.AudioCompression)
+	}
+	if config.FFTCompression != nil {
+		logCompression("FFT", &fftCompression, *config.FFTCompression)
 	}
 }
+
+func handleTextParsingError(text string) {
+	errorf("parsing text message: not JSON")
+	debugf("Raw message: %s", text)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"net.wadon/owrxp-playground/owrx"
+	"net.wadon/owrxp-playground/owrx/owrxtest"
+)
+
+// TestStatusWithAudio has StateAudioStarted reported from the reader while
+// Run reports the others, for -race to check lastState is guarded.
+func TestStatusWithAudio(t *testing.T) {
+	srv := owrxtest.NewServer()
+	defer srv.Close()
+
+	client = owrx.NewClient(srv.Addr(), owrx.WithReconnect(10*time.Millisecond, 10*time.Millisecond))
+	defer func() { client = nil }()
+	client.OnStatus(handleStatus)
+	audio := make(chan struct{}, 1)
+	client.OnAudio(func(frame owrx.AudioFrame) {
+		handleAudio(frame)
+		select {
+		case audio <- struct{}{}:
+		default:
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- client.Run(ctx) }()
+
+	for i := 0; i < 3; i++ {
+		conn, err := srv.Accept(2 * time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.SendAudio(make([]int16, 64), false); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-audio:
+		case <-time.After(2 * time.Second):
+			t.Fatal("no audio")
+		}
+		// As main does after Run, while the reader may still report.
+		clientState()
+		conn.Drop()
+	}
+
+	cancel()
+	<-done
+	if state := clientState(); state == owrx.StateAudioStarted {
+		t.Errorf("last state %v after Run returned", state)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+const defaultManualRecording = "rec_%Y%m%d_%H%M%S.wav"
+
+// manualRecorder is an audio output recording on request: between POST
+// /recording/start and /recording/stop, or from one -record-signal to the
+// next. Both start and stop the same recording.
+type manualRecorder struct {
+	mu  sync.Mutex
+	rec *recording
+}
+
+var (
+	manual = &manualRecorder{}
+
+	recordSignals chan os.Signal
+)
+
+// manualTemplate is the name template of a recording started on request:
+// the one asked for, else -o, else a timestamped default.
+func manualTemplate(template string) string {
+	if template == "" {
+		template = *output
+	}
+	if template == "" {
+		template = defaultManualRecording
+	}
+	return template
+}
+
+func (r *manualRecorder) active() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rec != nil
+}
+
+// start starts recording to template, or to manualTemplate's default when
+// it is empty.
+func (r *manualRecorder) start(template string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.startLocked(template)
+}
+
+func (r *manualRecorder) startLocked(template string) error {
+	if r.rec != nil {
+		return errors.New("already recording")
+	}
+	rec, err := openRecording(manualTemplate(template), false)
+	if err != nil {
+		return err
+	}
+	r.rec = rec
+	return nil
+}
+
+func (r *manualRecorder) stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.stopLocked()
+}
+
+func (r *manualRecorder) stopLocked() error {
+	if r.rec == nil {
+		return errors.New("not recording")
+	}
+	err := r.rec.Close()
+	r.rec = nil
+	infof("Recording stopped")
+	return err
+}
+
+// toggle stops the recording if there is one and starts one otherwise,
+// checking and acting under one lock so a stop or start from the API in
+// between can't turn it into the wrong one.
+func (r *manualRecorder) toggle() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rec != nil {
+		return r.stopLocked()
+	}
+	return r.startLocked("")
+}
+
+func (r *manualRecorder) WriteAudio(frame owrx.AudioFrame) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rec == nil {
+		return nil
+	}
+	return r.rec.WriteAudio(frame)
+}
+
+func (r *manualRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rec == nil {
+		return nil
+	}
+	err := r.rec.Close()
+	r.rec = nil
+	return err
+}
+
+// setupRecordSignal starts and stops the manual recording on every
+// -record-signal, so scripts can control captures without the API.
+func setupRecordSignal() {
+	if !*recordSignal {
+		return
+	}
+	sig, name := recordToggleSignal()
+	if sig == nil {
+		fatalf("-record-signal isn't supported on %s", runtime.GOOS)
+	}
+
+	recordSignals = make(chan os.Signal, 1)
+	signal.Notify(recordSignals, sig)
+	go func() {
+		for range recordSignals {
+			// Starting and stopping log what they did.
+			infof("Received %s", name)
+			if err := manual.toggle(); err != nil {
+				errorf("recording: %v", err)
+			}
+		}
+	}()
+	infof("Send %s to process %d to start or stop recording", name, os.Getpid())
+}
+
+// closeRecordSignal stops taking -record-signal, before the recording is
+// closed with the other outputs.
+func closeRecordSignal() {
+	if recordSignals == nil {
+		return
+	}
+	signal.Stop(recordSignals)
+	close(recordSignals)
+}
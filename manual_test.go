@@ -0,0 +1,34 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestManualToggleConcurrent toggles from several goroutines at once, like
+// signals arriving while the API is used: none may find the recording in
+// the state it checked a moment before.
+func TestManualToggleConcurrent(t *testing.T) {
+	*output = filepath.Join(t.TempDir(), "rec.wav")
+	defer func() { *output = "" }()
+
+	r := &manualRecorder{}
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				if err := r.toggle(); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if r.active() {
+		t.Error("recording after an even number of toggles")
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// memoryFileName is the -memory file in the user's config directory that is
+// used when -memory isn't given.
+const memoryFileName = "owrxp-playground/memory.csv"
+
+// The memory channels are read from the -memory file while validating the
+// flags and written back whenever one is stored. memoryNext is the channel
+// a recall without a number goes to.
+var (
+	memoryMu      sync.Mutex
+	memoryPath    string
+	memories      []scanChannel
+	memoryNext    int
+	recallApplied bool
+	recallIndex   = -1
+)
+
+func validateMemory() {
+	set := explicitFlags()
+	if *recallName == "" && !*interactive && !*tui && !set["memory"] {
+		return
+	}
+	if *recallName != "" && (*tuneFreq != 0 || *scanStart != 0 || *scanList != "" || *bookmarkName != "" || set["offset"]) {
+		fatalf("-recall can't be used with -freq, -offset, -bookmark, -scan-start or -scan-list")
+	}
+
+	memoryPath = *memoryFile
+	if memoryPath == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			if *recallName != "" {
+				fatalf("No -memory file: %v", err)
+			}
+			return
+		}
+		memoryPath = filepath.Join(dir, memoryFileName)
+	}
+
+	channels, err := readChannels(memoryPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fatalf("Failed to read -memory: %v", err)
+	}
+	memories = channels
+
+	if *recallName != "" {
+		i, ok := findMemory(*recallName)
+		if !ok {
+			fatalf("No memory channel %q in %s, give its name or its number from 1 to %d", *recallName, memoryPath, len(memories))
+		}
+		recallIndex = i
+	}
+}
+
+// findMemory looks a channel up by its number, counting from 1, or by its
+// name, case-insensitively.
+func findMemory(key string) (int, bool) {
+	if n, err := strconv.Atoi(key); err == nil {
+		return n - 1, n >= 1 && n <= len(memories)
+	}
+	for i, m := range memories {
+		if strings.EqualFold(m.Name, key) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// applyRecall tunes to -recall, once, as soon as the profile's center
+// frequency is known.
+func applyRecall(r receiverState) {
+	if recallIndex < 0 || recallApplied || r.CenterFreq == 0 || profilePending(r) {
+		return
+	}
+	recallApplied = true
+	recallMemory(recallIndex)
+}
+
+// recallMemory tunes to memory channel i along with its mode and squelch
+// level.
+func recallMemory(i int) {
+	memoryMu.Lock()
+	if i < 0 || i >= len(memories) {
+		memoryMu.Unlock()
+		errorf("no memory channel %d, there are %d", i+1, len(memories))
+		return
+	}
+	m := memories[i]
+	memoryNext = (i + 1) % len(memories)
+	memoryMu.Unlock()
+
+	offset, err := currentReceiver().offsetFor(m.Frequency)
+	if err != nil {
+		errorf("can't recall memory channel %d: %v; pick another profile", i+1, err)
+		return
+	}
+
+	infof("Recalling memory channel %d: %s", i+1, memoryLine(m))
+	updateDSP(func(s *owrx.DSP) {
+		s.OffsetFreq = offset
+		if mode, ok := owrx.FindMode(m.Mode); ok && s.Mod != m.Mode {
+			s.SetMode(mode)
+		}
+		if m.Squelch != nil {
+			s.SquelchLevel = *m.Squelch
+		}
+	})
+}
+
+// recallNextMemory goes to the channel after the one recalled last.
+func recallNextMemory() {
+	memoryMu.Lock()
+	n, next := len(memories), memoryNext
+	memoryMu.Unlock()
+
+	if n == 0 {
+		errorf("no memory channels yet, store one with s")
+		return
+	}
+	recallMemory(next)
+}
+
+// storeMemory saves the tuned frequency, mode and squelch level to the
+// -memory file. A channel already stored at the frequency is updated and
+// keeps its name.
+func storeMemory() {
+	r := currentReceiver()
+	if r.CenterFreq == 0 {
+		errorf("can't store a memory channel before the server sends its center frequency")
+		return
+	}
+	if memoryPath == "" {
+		errorf("can't store a memory channel without a -memory file")
+		return
+	}
+	s := currentDSP()
+	level := s.SquelchLevel
+	channel := scanChannel{Frequency: r.CenterFreq + int64(s.OffsetFreq), Mode: s.Mod, Squelch: &level}
+
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	i := len(memories)
+	for j, m := range memories {
+		if m.Frequency == channel.Frequency {
+			i, channel.Name = j, m.Name
+		}
+	}
+	if i == len(memories) {
+		memories = append(memories, channel)
+	} else {
+		memories[i] = channel
+	}
+
+	if err := writeMemories(memoryPath, memories); err != nil {
+		errorf("writing %s: %v", memoryPath, err)
+		return
+	}
+	infof("Stored memory channel %d: %s", i+1, memoryLine(channel))
+}
+
+// memoryAt finds the memory channel key names: a number counting from 1,
+// or without one the channel stored at the tuned frequency.
+func memoryAt(key string) (int, error) {
+	var freq int64
+	if key == "" {
+		freq = tunedFrequency(currentReceiver(), currentDSP().OffsetFreq)
+	}
+
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	if key != "" {
+		i, ok := findMemory(key)
+		if !ok {
+			return 0, fmt.Errorf("no memory channel %s, there are %d", key, len(memories))
+		}
+		return i, nil
+	}
+	for i, m := range memories {
+		if freq != 0 && m.Frequency == freq {
+			return i, nil
+		}
+	}
+	return 0, errors.New("no memory channel at the tuned frequency, type its number first")
+}
+
+// memoryName is the name of memory channel i, or "" if there is none.
+func memoryName(i int) string {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	if i < 0 || i >= len(memories) {
+		return ""
+	}
+	return memories[i].Name
+}
+
+// nameMemory names memory channel i and saves the -memory file. An empty
+// name removes the one it had.
+func nameMemory(i int, name string) {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	if i < 0 || i >= len(memories) {
+		errorf("no memory channel %d, there are %d", i+1, len(memories))
+		return
+	}
+	memories[i].Name = strings.TrimSpace(name)
+	if err := writeMemories(memoryPath, memories); err != nil {
+		errorf("writing %s: %v", memoryPath, err)
+		return
+	}
+	infof("Named memory channel %d: %s", i+1, memoryLine(memories[i]))
+}
+
+// deleteMemory removes memory channel i and saves the -memory file. The
+// channels after it move up a number.
+func deleteMemory(i int) {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	if i < 0 || i >= len(memories) {
+		errorf("no memory channel %d, there are %d", i+1, len(memories))
+		return
+	}
+	m := memories[i]
+	memories = append(memories[:i], memories[i+1:]...)
+	switch {
+	case memoryNext > i:
+		memoryNext--
+	case memoryNext >= len(memories):
+		memoryNext = 0
+	}
+	if err := writeMemories(memoryPath, memories); err != nil {
+		errorf("writing %s: %v", memoryPath, err)
+		return
+	}
+	infof("Deleted memory channel %d: %s", i+1, memoryLine(m))
+}
+
+// memoryLine describes a memory channel with the settings it stores.
+func memoryLine(m scanChannel) string {
+	line := m.String()
+	if m.Mode != "" {
+		line += " " + strings.ToUpper(m.Mode)
+	}
+	if m.Squelch != nil {
+		line += fmt.Sprintf(" sq %d dB", *m.Squelch)
+	}
+	return line
+}
+
+// logMemories lists the memory channels with their numbers.
+func logMemories() {
+	memoryMu.Lock()
+	defer memoryMu.Unlock()
+
+	if len(memories) == 0 {
+		infof("No memory channels in %s", memoryPath)
+		return
+	}
+	infof("Memory channels in %s:", memoryPath)
+	for i, m := range memories {
+		infof("  %d: %s", i+1, memoryLine(m))
+	}
+}
+
+// writeMemories replaces the file with channels in the -scan-list format,
+// through a temporary file so a failed write leaves the old list. The file
+// keeps its permissions, or gets 0644 when it is new.
+func writeMemories(path string, channels []scanChannel) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := csv.NewWriter(tmp)
+	w.Write([]string{"frequency", "mode", "squelch", "name"})
+	for _, c := range channels {
+		squelch := ""
+		if c.Squelch != nil {
+			squelch = strconv.Itoa(*c.Squelch)
+		}
+		w.Write([]string{strconv.FormatInt(c.Frequency, 10), c.Mode, squelch, c.Name})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	// CreateTemp makes the file readable by its owner only.
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing: %v", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteMemoriesMode(t *testing.T) {
+	dir := t.TempDir()
+	channels := []scanChannel{{Frequency: 145500000, Mode: "nfm", Name: "Calling"}}
+
+	fresh := filepath.Join(dir, "new.csv")
+	if err := writeMemories(fresh, channels); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(fresh); err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("new file: %v, %v, want mode 0644", info.Mode(), err)
+	}
+
+	existing := filepath.Join(dir, "existing.csv")
+	if err := os.WriteFile(existing, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(existing, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeMemories(existing, channels); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(existing); err != nil || info.Mode().Perm() != 0o640 {
+		t.Errorf("existing file: %v, %v, want its mode 0640 kept", info.Mode(), err)
+	}
+}
+
+func TestNameAndDeleteMemory(t *testing.T) {
+	memoryPath = filepath.Join(t.TempDir(), "memory.csv")
+	memories = []scanChannel{{Frequency: 1}, {Frequency: 2}, {Frequency: 3}}
+	memoryNext = 2
+	defer func() { memoryPath, memories, memoryNext = "", nil, 0 }()
+
+	nameMemory(1, " Repeater ")
+	deleteMemory(0)
+
+	channels, err := readChannels(memoryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 2 || channels[0].Frequency != 2 || channels[0].Name != "Repeater" || channels[1].Frequency != 3 {
+		t.Errorf("memory file holds %+v, want the named channel 2 and channel 3", channels)
+	}
+	if memoryNext != 1 {
+		t.Errorf("next channel %d, want 1, still channel 3", memoryNext)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// dmrMetadata is the digital voice metadata the server sends while
+// decoding DMR: who is talking to whom on which timeslot.
+type dmrMetadata struct {
+	Slot      int    `json:"slot"`
+	Sync      string `json:"sync,omitempty"`
+	CallType  string `json:"call_type,omitempty"`
+	Source    string `json:"source,omitempty"`
+	Target    string `json:"target,omitempty"`
+	Callsign  string `json:"callsign,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Alias     string `json:"talker_alias,omitempty"`
+	ColorCode *int   `json:"color_code,omitempty"`
+}
+
+var (
+	metadataMu sync.Mutex
+	dmrCalls   = map[int]dmrMetadata{}
+)
+
+func handleMetadata(value owrx.Metadata) {
+	if value.Protocol != "DMR" {
+		return
+	}
+
+	m := dmrMetadata{
+		// OpenWebRX numbers the timeslots from 0.
+		Slot:      value.Slot + 1,
+		Sync:      value.Sync,
+		CallType:  value.CallType,
+		Source:    string(value.Source),
+		Target:    string(value.Target),
+		Alias:     value.TalkerAlias,
+		ColorCode: value.ColorCode,
+	}
+	if additional := value.Additional; additional != nil {
+		m.Callsign = additional.Callsign
+		m.Name = additional.FirstName
+	}
+
+	// The metadata repeats throughout a transmission, so only changes of
+	// the call on a slot are logged.
+	metadataMu.Lock()
+	last, seen := dmrCalls[m.Slot]
+	dmrCalls[m.Slot] = m
+	metadataMu.Unlock()
+
+	if m.Source == "" || (seen && last.Source == m.Source && last.Target == m.Target && last.Callsign == m.Callsign && last.Alias == m.Alias) {
+		return
+	}
+	infof("DMR TS%d: %s", m.Slot, m)
+	dumpEvent("dmr", m)
+	recordDecoded("dmr", m)
+}
+
+func (m dmrMetadata) String() string {
+	talker := m.Source
+	switch {
+	case m.Callsign != "" && m.Name != "":
+		talker = fmt.Sprintf("%s %s (%s)", m.Callsign, m.Name, m.Source)
+	case m.Callsign != "":
+		talker = fmt.Sprintf("%s (%s)", m.Callsign, m.Source)
+	case m.Alias != "":
+		talker = fmt.Sprintf("%s (%s)", m.Alias, m.Source)
+	}
+
+	target := m.Target
+	switch m.CallType {
+	case "group":
+		target = "TG " + m.Target
+	case "direct":
+		target = "ID " + m.Target
+	}
+
+	s := talker
+	if m.Target != "" {
+		s += " -> " + target
+	}
+	if m.ColorCode != nil {
+		s += fmt.Sprintf(", CC %d", *m.ColorCode)
+	}
+	return s
+}
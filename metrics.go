@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// metrics collects the counters served in the Prometheus text format on
+// -metrics-addr.
+type metrics struct {
+	mu         sync.Mutex
+	messages   map[string]uint64
+	bytes      map[string]uint64
+	smeter     float64
+	smeterSeen bool
+	reconnects uint64
+	connected  bool
+}
+
+var (
+	stats       *metrics
+	statsServer *http.Server
+)
+
+var binaryMessageNames = map[byte]string{
+	1: "fft",
+	2: "audio",
+	3: "secondary_fft",
+	4: "hd_audio",
+}
+
+func setupMetrics() {
+	if *metricsAddr == "" {
+		return
+	}
+
+	stats = &metrics{
+		messages: make(map[string]uint64),
+		bytes:    make(map[string]uint64),
+	}
+	addSmeterHandler(stats.handleSmeter)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", stats.serve)
+	// Listening happens here, so a taken address fails the start rather
+	// than a running session.
+	listener, err := net.Listen("tcp", *metricsAddr)
+	if err != nil {
+		fatalf("Metrics server: %v", err)
+	}
+	statsServer = &http.Server{Handler: mux}
+	go func() {
+		if err := statsServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			errorf("Metrics server: %v", err)
+		}
+	}()
+	infof("Serving metrics on http://%s/metrics", *metricsAddr)
+}
+
+func closeMetrics() {
+	if statsServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	statsServer.Shutdown(ctx)
+}
+
+// countMessage counts a received message of the given kind.
+func countMessage(kind string, size int) {
+	if stats == nil {
+		return
+	}
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	stats.messages[kind]++
+	stats.bytes[kind] += uint64(size)
+}
+
+// countRawMessage counts a message as received, under its messageKind.
+func countRawMessage(messageType int, message []byte) {
+	if stats == nil || len(message) == 0 {
+		return
+	}
+	countMessage(messageKind(messageType, message), len(message))
+}
+
+// messageKind is what a message is counted under: a text message's type
+// field, or "text" if it isn't JSON, a binary message's kind.
+func messageKind(messageType int, message []byte) string {
+	if messageType == websocket.BinaryMessage {
+		return binaryMessageName(message[0])
+	}
+	var msg struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(message, &msg) == nil {
+		return msg.Type
+	}
+	return "text"
+}
+
+func binaryMessageName(firstByte byte) string {
+	if name, ok := binaryMessageNames[firstByte]; ok {
+		return name
+	}
+	return "binary_" + strconv.Itoa(int(firstByte))
+}
+
+func countReconnect() {
+	if stats == nil {
+		return
+	}
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	stats.reconnects++
+}
+
+func setConnected(connected bool) {
+	if stats == nil {
+		return
+	}
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	stats.connected = connected
+}
+
+func (m *metrics) handleSmeter(r smeterReading) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.smeter = r.Value
+	m.smeterSeen = true
+}
+
+func (m *metrics) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeMetricHeader(w, "owrxp_messages_total", "counter", "Messages received from the server by type.")
+	for _, kind := range sortedKeys(m.messages) {
+		fmt.Fprintf(w, "owrxp_messages_total{type=%q} %d\n", kind, m.messages[kind])
+	}
+	writeMetricHeader(w, "owrxp_message_bytes_total", "counter", "Bytes received from the server by message type.")
+	for _, kind := range sortedKeys(m.bytes) {
+		fmt.Fprintf(w, "owrxp_message_bytes_total{type=%q} %d\n", kind, m.bytes[kind])
+	}
+
+	if m.smeterSeen {
+		writeMetricHeader(w, "owrxp_smeter", "gauge", "Latest smeter reading as linear power.")
+		fmt.Fprintf(w, "owrxp_smeter %g\n", m.smeter)
+		if db := smeterDB(m.smeter); smeterCalibrated && !math.IsInf(db, -1) {
+			writeMetricHeader(w, "owrxp_smeter_dbm", "gauge", "Latest smeter reading in dBm, calibrated with -smeter-cal.")
+			fmt.Fprintf(w, "owrxp_smeter_dbm %g\n", smeterDBm(db))
+		}
+	}
+
+	writeMetricHeader(w, "owrxp_reconnects_total", "counter", "Reconnect attempts.")
+	fmt.Fprintf(w, "owrxp_reconnects_total %d\n", m.reconnects)
+
+	writeMetricHeader(w, "owrxp_connected", "gauge", "Whether the client is connected to the server.")
+	fmt.Fprintf(w, "owrxp_connected %d\n", boolMetric(m.connected))
+
+	latency.mu.Lock()
+	if latency.count > 0 {
+		writeMetricHeader(w, "owrxp_control_latency_seconds", "gauge", "Round trip of the latest control message to the server.")
+		fmt.Fprintf(w, "owrxp_control_latency_seconds %g\n", latency.last.Seconds())
+		writeMetricHeader(w, "owrxp_control_round_trip_seconds", "summary", "Round trips of the control messages sent to the server.")
+		fmt.Fprintf(w, "owrxp_control_round_trip_seconds_sum %g\n", latency.sum.Seconds())
+		fmt.Fprintf(w, "owrxp_control_round_trip_seconds_count %d\n", latency.count)
+	}
+	latency.mu.Unlock()
+
+	if s := currentServer(); s != nil {
+		writeMetricHeader(w, "owrxp_server_info", "gauge", "The server software connected to, as given in its handshake.")
+		fmt.Fprintf(w, "owrxp_server_info{name=%q,version=%q} 1\n", s.Name, s.Version)
+	}
+
+	if d := currentDetails(); d != nil {
+		writeMetricHeader(w, "owrxp_receiver_info", "gauge", "The receiver connected to, as given by its operator.")
+		fmt.Fprintf(w, "owrxp_receiver_info{name=%q,location=%q} 1\n", d.Name, d.Location)
+	}
+
+	if audioBuffer != nil {
+		stats := currentAudioStats()
+		writeMetricHeader(w, "owrxp_audio_dropped_samples_total", "counter", "Audio samples dropped because the outputs fell behind.")
+		fmt.Fprintf(w, "owrxp_audio_dropped_samples_total %d\n", stats.Buffer.Dropped)
+		writeMetricHeader(w, "owrxp_audio_buffered_seconds", "gauge", "Audio waiting in the buffer for the outputs.")
+		fmt.Fprintf(w, "owrxp_audio_buffered_seconds %g\n", stats.Buffer.Buffered.Seconds())
+		writeMetricHeader(w, "owrxp_audio_overruns_total", "counter", "Times a full audio buffer had to drop audio.")
+		fmt.Fprintf(w, "owrxp_audio_overruns_total %d\n", stats.Overruns())
+		writeMetricHeader(w, "owrxp_audio_latency_seconds", "gauge", "Estimated time from receiving audio to playing or writing it.")
+		fmt.Fprintf(w, "owrxp_audio_latency_seconds %g\n", stats.Latency().Seconds())
+		if stats.Playback != nil {
+			writeMetricHeader(w, "owrxp_playback_buffered_seconds", "gauge", "Audio in the playback jitter buffer.")
+			fmt.Fprintf(w, "owrxp_playback_buffered_seconds %g\n", stats.Playback.Buffered.Seconds())
+			writeMetricHeader(w, "owrxp_playback_underruns_total", "counter", "Times the playback buffer ran dry.")
+			fmt.Fprintf(w, "owrxp_playback_underruns_total %d\n", stats.Underruns)
+		}
+	}
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func boolMetric(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+func validateMode() {
+	if _, ok := owrx.FindMode(*mod); !ok {
+		fatalf("Unknown -mod %q, known modes: %s", *mod, strings.Join(owrx.ModeNames(), ", "))
+	}
+}
+
+// checkServerModes warns when the server's list of modes lacks the one in
+// use, e.g. a digital mode whose decoder isn't installed.
+func checkServerModes(modes []owrx.ServerMode) {
+	current := currentDSP().Mod
+	for _, m := range modes {
+		if m.Modulation == current {
+			return
+		}
+	}
+	warnf("the server doesn't offer mode %q", current)
+}
+
+// startCuts is the passband to start with: the mode's default unless set by
+// -lowcut or -highcut.
+func startCuts(mode owrx.Mode) (low, high int) {
+	low, high = mode.LowCut, mode.HighCut
+	set := explicitFlags()
+	if set["lowcut"] {
+		low = *lowCut
+	}
+	if set["highcut"] {
+		high = *highCut
+	}
+	return low, high
+}
+
+// minBandwidth is the narrowest passband that seems intended.
+const minBandwidth = 100
+
+func validateCuts() {
+	mode, _ := owrx.FindMode(*mod)
+	low, high := startCuts(mode)
+	if low >= high {
+		fatalf("-lowcut %d must be below -highcut %d", low, high)
+	}
+
+	width, usual := high-low, mode.HighCut-mode.LowCut
+	if width < minBandwidth || width > 2*usual {
+		warnf("a %d Hz passband is unusual for %s, which defaults to %d Hz (%d to %d)", width, mode.Name, usual, mode.LowCut, mode.HighCut)
+	}
+}
+
+// dmrFilter is the DMR timeslot filter -dmr-filter names, a bitmask of
+// the timeslots to pass.
+var dmrFilter = owrx.DMRBothTimeslots
+
+func validateDMRFilter() {
+	filter, err := owrx.ParseDMRFilter(*dmrFilterName)
+	if err != nil {
+		fatalf("Invalid -dmr-filter: %v", err)
+	}
+	dmrFilter = filter
+}
+
+// validateCTCSS checks -ctcss is a standard tone. The tone squelch only
+// makes sense on FM, so a warning is logged for other modes.
+func validateCTCSS() {
+	if *ctcss == 0 {
+		return
+	}
+	if _, ok := owrx.FindCTCSSTone(*ctcss); !ok {
+		tones := make([]string, len(owrx.CTCSSTones))
+		for i, tone := range owrx.CTCSSTones {
+			tones[i] = strconv.FormatFloat(tone, 'f', 1, 64)
+		}
+		fatalf("-ctcss %g is not a standard CTCSS tone, use one of %s", *ctcss, strings.Join(tones, ", "))
+	}
+	if *mod != "nfm" {
+		warnf("-ctcss has no effect in %s mode, only on nfm", *mod)
+	}
+}
+
+func dmrSlots(filter int) string {
+	switch filter {
+	case owrx.DMRTimeslot1:
+		return "TS1"
+	case owrx.DMRTimeslot2:
+		return "TS2"
+	}
+	return "TS1+2"
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+var (
+	muteMu sync.Mutex
+	muted  bool
+)
+
+func isMuted() bool {
+	muteMu.Lock()
+	defer muteMu.Unlock()
+
+	return muted
+}
+
+// setMuted mutes or unmutes the audio going to the outputs. The server
+// keeps sending it, since stopping its DSP would stop the smeter too.
+func setMuted(m bool) {
+	muteMu.Lock()
+	changed := muted != m
+	muted = m
+	muteMu.Unlock()
+
+	if !changed {
+		return
+	}
+	if m {
+		infof("Audio muted")
+	} else {
+		infof("Audio unmuted")
+	}
+}
+
+func toggleMute() {
+	setMuted(!isMuted())
+}
+
+// muteFrame replaces a frame with silence of the same length while muted.
+// The outputs keep getting audio, so playback doesn't run dry and
+// recordings keep their timing.
+func muteFrame(frame owrx.AudioFrame) owrx.AudioFrame {
+	if !isMuted() {
+		return frame
+	}
+	frame.Samples = make([]int16, len(frame.Samples))
+	return frame
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxNotchFreq is the highest audio frequency -notch accepts, the top of
+// the widest passband.
+const maxNotchFreq = 12000
+
+var notchFreqs notchFlags
+
+// notchFlags collects the -notch frequencies, given separated by commas or
+// with the flag repeated.
+type notchFlags []int
+
+func (n *notchFlags) String() string {
+	freqs := make([]string, len(*n))
+	for i, f := range *n {
+		freqs[i] = strconv.Itoa(f)
+	}
+	return strings.Join(freqs, ",")
+}
+
+func (n *notchFlags) Set(value string) error {
+	for _, field := range strings.Split(value, ",") {
+		freq, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || freq <= 0 || freq > maxNotchFreq {
+			return fmt.Errorf("notch frequency %q is not a number of Hz from 1 to %d", field, maxNotchFreq)
+		}
+		*n = append(*n, freq)
+	}
+	return nil
+}
+
+// notchStatus describes the notch filter for the status line, or is empty
+// when it is off.
+func notchStatus(auto bool, freqs []int) string {
+	var parts []string
+	if auto {
+		parts = append(parts, "auto")
+	}
+	for _, f := range freqs {
+		parts = append(parts, strconv.Itoa(f))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "notch " + strings.Join(parts, ",")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net.wadon/owrxp-playground/owrx"
+)
+
+const (
+	// nrFeature is the server feature that says it can reduce noise.
+	nrFeature      = "nr"
+	minNRThreshold = 0
+	maxNRThreshold = 20
+)
+
+func validateNR() {
+	if *nrLevel < minNRThreshold || *nrLevel > maxNRThreshold {
+		fatalf("-nr-level must be between %d and %d dB, got %d", minNRThreshold, maxNRThreshold, *nrLevel)
+	}
+}
+
+// resetNR leaves noise reduction out of the demodulator setup until the
+// features of the server being connected to are known.
+func resetNR() {
+	updateDSP(func(s *owrx.DSP) {
+		s.NRAvailable = false
+	})
+}
+
+// applyNR sends the noise reduction settings once the features message
+// says the server has it. Without it they are never sent, and asking for
+// noise reduction gets a warning.
+func applyNR(features map[string]bool) {
+	if !features[nrFeature] {
+		if currentDSP().NoiseReduction {
+			warnf("the server doesn't support noise reduction, ignoring -nr")
+		}
+		return
+	}
+	s := updateDSP(func(s *owrx.DSP) {
+		s.NRAvailable = true
+	})
+	if s.NoiseReduction {
+		infof("Noise reduction on, %d dB", s.NRThreshold)
+	}
+}
+
+// toggleNR switches noise reduction on or off.
+func toggleNR() {
+	changeNR(func(s *owrx.DSP) {
+		s.NoiseReduction = !s.NoiseReduction
+	})
+}
+
+func adjustNR(delta int) {
+	changeNR(func(s *owrx.DSP) {
+		s.NRThreshold = clamp(s.NRThreshold+delta, minNRThreshold, maxNRThreshold)
+	})
+}
+
+// changeNR applies change, which is only sent if the server supports
+// noise reduction.
+func changeNR(change func(s *owrx.DSP)) {
+	if s := updateDSP(change); !s.NRAvailable && client.Connected() {
+		warnf("the server doesn't support noise reduction")
+	}
+}
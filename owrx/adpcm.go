@@ -0,0 +1,136 @@
+package owrx
+
+var adpcmIndexTable = [16]int{
+	-1, -1, -1, -1, 2, 4, 6, 8,
+	-1, -1, -1, -1, 2, 4, 6, 8,
+}
+
+var adpcmStepTable = [89]int{
+	7, 8, 9, 10, 11, 12, 13, 14, 16, 17,
+	19, 21, 23, 25, 28, 31, 34, 37, 41, 45,
+	50, 55, 60, 66, 73, 80, 88, 97, 107, 118,
+	130, 143, 157, 173, 190, 209, 230, 253, 279, 307,
+	337, 371, 408, 449, 494, 544, 598, 658, 724, 796,
+	876, 963, 1060, 1166, 1282, 1411, 1552, 1707, 1878, 2066,
+	2272, 2499, 2749, 3024, 3327, 3660, 4026, 4428, 4871, 5358,
+	5894, 6484, 7132, 7845, 8630, 9493, 10442, 11487, 12635, 13899,
+	15289, 16818, 18500, 20350, 22385, 24623, 27086, 29794, 32767,
+}
+
+// OpenWebRX interleaves its ADPCM audio stream with "SYNC" markers followed
+// by the encoder's step index and predictor (both int16, little endian), so
+// a client can pick up the stream at any point.
+const (
+	adpcmSyncWord     = "SYNC"
+	adpcmSyncInterval = 1000
+)
+
+const (
+	adpcmPhaseSearch = iota
+	adpcmPhaseHeader
+	adpcmPhaseData
+)
+
+// ADPCMState is the IMA ADPCM decoder state carried across frames.
+type ADPCMState struct {
+	predictor int
+	stepIndex int
+
+	phase       int
+	syncMatched int
+	header      [4]byte
+	headerLen   int
+	syncCounter int
+}
+
+// Reset returns the decoder to its initial, unsynchronised state.
+func (s *ADPCMState) Reset() {
+	*s = ADPCMState{}
+}
+
+func (s *ADPCMState) decodeNibble(nibble byte) int16 {
+	step := adpcmStepTable[s.stepIndex]
+
+	diff := step >> 3
+	if nibble&1 != 0 {
+		diff += step >> 2
+	}
+	if nibble&2 != 0 {
+		diff += step >> 1
+	}
+	if nibble&4 != 0 {
+		diff += step
+	}
+	if nibble&8 != 0 {
+		diff = -diff
+	}
+
+	s.predictor = clamp(s.predictor+diff, -32768, 32767)
+	s.stepIndex = clamp(s.stepIndex+adpcmIndexTable[nibble], 0, len(adpcmStepTable)-1)
+
+	return int16(s.predictor)
+}
+
+// decodeADPCM decodes a chunk of the OpenWebRX audio stream. Bytes received
+// before the first sync marker are discarded.
+func decodeADPCM(data []byte, state *ADPCMState) []int16 {
+	samples := make([]int16, 0, len(data)*2)
+
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+
+		switch state.phase {
+		case adpcmPhaseSearch:
+			if b == adpcmSyncWord[state.syncMatched] {
+				state.syncMatched++
+			} else {
+				state.syncMatched = 0
+			}
+			if state.syncMatched == len(adpcmSyncWord) {
+				state.syncMatched = 0
+				state.headerLen = 0
+				state.phase = adpcmPhaseHeader
+			}
+		case adpcmPhaseHeader:
+			state.header[state.headerLen] = b
+			state.headerLen++
+			if state.headerLen == len(state.header) {
+				stepIndex := int(int16(uint16(state.header[0]) | uint16(state.header[1])<<8))
+				state.stepIndex = clamp(stepIndex, 0, len(adpcmStepTable)-1)
+				state.predictor = int(int16(uint16(state.header[2]) | uint16(state.header[3])<<8))
+				state.syncCounter = adpcmSyncInterval
+				state.phase = adpcmPhaseData
+			}
+		case adpcmPhaseData:
+			if state.syncCounter == 0 {
+				state.phase = adpcmPhaseSearch
+				i--
+				continue
+			}
+			state.syncCounter--
+			samples = append(samples, state.decodeNibble(b&0x0f), state.decodeNibble(b>>4))
+		}
+	}
+
+	return samples
+}
+
+// decodeADPCMBlock decodes plain IMA ADPCM without sync markers, as used
+// for compressed FFT frames.
+func decodeADPCMBlock(data []byte, state *ADPCMState) []int16 {
+	samples := make([]int16, 0, len(data)*2)
+	for _, b := range data {
+		samples = append(samples, state.decodeNibble(b&0x0f), state.decodeNibble(b>>4))
+	}
+	return samples
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,84 @@
+package owrx
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxHeldAudio is how much audio the client holds while no audio handler
+// is registered.
+const maxHeldAudio = 5 * time.Second
+
+// AudioFrame is a block of decoded mono PCM audio. HD frames carry the
+// wideband stream sent at hd_output_rate.
+type AudioFrame struct {
+	Samples []int16
+	Rate    int
+	HD      bool
+}
+
+func (f AudioFrame) duration() time.Duration {
+	if f.Rate == 0 {
+		return 0
+	}
+	return time.Duration(len(f.Samples)) * time.Second / time.Duration(f.Rate)
+}
+
+// audioDecoder decodes the normal and HD audio streams of one connection
+// with the compression the server announced.
+type audioDecoder struct {
+	mu          sync.Mutex
+	compression string
+	rate        int
+	hdRate      int
+	codec       AudioCodec
+	hdCodec     AudioCodec
+}
+
+// reset starts both streams afresh, as the codecs carry state across
+// frames.
+func (d *audioDecoder) reset() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.resetLocked()
+}
+
+func (d *audioDecoder) resetLocked() error {
+	var err error
+	d.codec, err = newAudioCodec(d.compression, d.rate)
+	d.hdCodec, _ = newAudioCodec(d.compression, d.hdRate)
+	return err
+}
+
+// setCompression switches to the compression named in a config message.
+func (d *audioDecoder) setCompression(compression string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if compression == d.compression && d.codec != nil {
+		return nil
+	}
+	d.compression = compression
+	return d.resetLocked()
+}
+
+func (d *audioDecoder) decode(data []byte, hd bool) (AudioFrame, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.codec == nil {
+		d.resetLocked()
+	}
+	codec, rate := d.codec, d.rate
+	if hd {
+		codec, rate = d.hdCodec, d.hdRate
+	}
+
+	samples, err := codec.Decode(data)
+	if err != nil {
+		return AudioFrame{}, fmt.Errorf("decoding audio: %v", err)
+	}
+	return AudioFrame{Samples: samples, Rate: codecRate(codec, rate), HD: hd}, nil
+}
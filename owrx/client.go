@@ -0,0 +1,922 @@
+// Package owrx is a client for the WebSocket protocol OpenWebRX serves its
+// web receiver on. A Client connects to a server, keeps the demodulator
+// set up across connections, decodes the audio and FFT streams and hands
+// everything it receives to the handlers registered on it.
+package owrx
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeTimeout is how long Close waits for the server to acknowledge the
+// close frame.
+const closeTimeout = 2 * time.Second
+
+// maxLatencyProbes bounds the control round trips waiting for their pong,
+// should the server stop answering pings.
+const maxLatencyProbes = 16
+
+// latencyProbePrefix marks the pings that time a control message, telling
+// their pongs apart from the keepalive's.
+const latencyProbePrefix = "rtt-"
+
+// ErrNotConnected is returned when sending without a connection.
+var ErrNotConnected = errors.New("not connected")
+
+// ErrMalformedFrame is wrapped by the errors reported for binary messages
+// that are too short or the wrong size for their type. Such a message is
+// skipped and the connection carries on.
+var ErrMalformedFrame = errors.New("malformed frame")
+
+// ErrReconnectLimit is returned by Run when it has reconnected as often as
+// WithReconnectLimit allows.
+var ErrReconnectLimit = errors.New("reconnect limit reached")
+
+// Client is a connection to an OpenWebRX server. It can connect again after
+// a connection ends, replaying the profile and demodulator setup.
+//
+// Handlers should be registered before connecting; they run on the
+// connection's reader goroutine, so they must not block for long.
+type Client struct {
+	addr           string
+	path           string
+	secure         bool
+	tlsConfig      *tls.Config
+	header         http.Header
+	connectTimeout time.Duration
+	outputRate     int
+	hdOutputRate   int
+	pingInterval   time.Duration
+	pingTimeout    time.Duration
+	reconnect      bool
+	backoffBase    time.Duration
+	backoffMax     time.Duration
+	maxReconnects  int
+	dryRun         bool
+	optionErr      error
+	passband       *[2]int // WithPassband's, set over WithMode's
+
+	// mu guards the connection and what the server told about it.
+	mu             sync.Mutex
+	conn           *websocket.Conn
+	done           chan struct{}
+	err            error
+	backoff        time.Duration
+	closeErr       error // err until retryDelay consults it
+	handshake      HandshakeMessage
+	profile        string
+	centerFreq     int64
+	sampleRate     int64
+	fftCompression string
+	fftSize        int
+	secondaryFFT   int
+	probes         map[string]time.Time
+	probeSeq       uint64
+	// failing holds the binary message types whose last message couldn't
+	// be decoded, so a run of bad ones is reported once.
+	failing map[byte]bool
+
+	// writeMu serializes writes, which the websocket package requires.
+	writeMu sync.Mutex
+
+	dspMu sync.Mutex
+	dsp   DSP
+
+	audio audioDecoder
+
+	handlersMu      sync.Mutex
+	heldAudio       []AudioFrame
+	audioStarted    bool
+	audioHandlers   []func(frame AudioFrame)
+	fftHandlers     []func(bins []float32)
+	secondaryFFTs   []func(bins []float32)
+	smeterHandlers  []func(value float64)
+	messageHandlers []func(msg Message)
+	textHandlers    []func(text string)
+	rawHandlers     []func(messageType int, data []byte)
+	errorHandlers   []func(err error)
+	sendHandlers    []func(message []byte, sent bool)
+	latencyHandlers []func(rtt time.Duration)
+	statusHandlers  []func(status Status)
+}
+
+// NewClient returns a client for the server at addr, a host and port. A
+// ws://, wss://, http:// or https:// prefix picks the scheme, which is
+// otherwise ws:// unless WithTLS is given. Without options the client
+// listens to NFM at the center of the server's default profile.
+func NewClient(addr string, opts ...Option) *Client {
+	nfm, _ := FindMode("nfm")
+	c := &Client{
+		addr:           addr,
+		path:           "/ws/",
+		connectTimeout: 10 * time.Second,
+		outputRate:     11025,
+		hdOutputRate:   44100,
+		pingInterval:   30 * time.Second,
+		pingTimeout:    10 * time.Second,
+		fftCompression: "none",
+		dsp: DSP{
+			Mod:          nfm.Name,
+			LowCut:       nfm.LowCut,
+			HighCut:      nfm.HighCut,
+			SquelchLevel: -150,
+			DMRFilter:    DMRBothTimeslots,
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	// The passband is set last, so WithMode's default doesn't replace it
+	// when the options come in the other order.
+	if c.passband != nil {
+		c.dsp.LowCut, c.dsp.HighCut = c.passband[0], c.passband[1]
+	}
+	return c
+}
+
+// URL returns the WebSocket URL the client connects to.
+func (c *Client) URL() string {
+	host, secure := c.addr, c.secure
+	for _, prefix := range []struct {
+		scheme string
+		tls    bool
+	}{
+		{"ws://", false},
+		{"http://", false},
+		{"wss://", true},
+		{"https://", true},
+	} {
+		if strings.HasPrefix(host, prefix.scheme) {
+			host = strings.TrimPrefix(host, prefix.scheme)
+			secure = prefix.tls
+			break
+		}
+	}
+
+	u := url.URL{Scheme: "ws", Host: strings.TrimSuffix(host, "/"), Path: c.path}
+	if secure {
+		u.Scheme = "wss"
+	}
+	return u.String()
+}
+
+// OnAudio registers a handler for decoded audio, both the normal and the
+// HD stream. Audio arriving before the first handler is registered is held,
+// up to its last five seconds, and handed to it ahead of the next frame, so
+// the start of a transmission isn't lost to late setup.
+func (c *Client) OnAudio(handler func(frame AudioFrame)) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.audioHandlers = append(c.audioHandlers, handler)
+}
+
+// OnFFT registers a handler for decoded FFT frames. See DecodeFFT.
+func (c *Client) OnFFT(handler func(bins []float32)) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.fftHandlers = append(c.fftHandlers, handler)
+}
+
+// OnSecondaryFFT registers a handler for the FFT frames of the secondary
+// demodulator, sent while one runs. They are decoded like the main FFT,
+// see DecodeFFT, and hold the secondary_fft_size bins of its
+// secondary_config message.
+func (c *Client) OnSecondaryFFT(handler func(bins []float32)) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.secondaryFFTs = append(c.secondaryFFTs, handler)
+}
+
+// OnSmeter registers a handler for smeter readings, a linear power.
+func (c *Client) OnSmeter(handler func(value float64)) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.smeterHandlers = append(c.smeterHandlers, handler)
+}
+
+// OnMessage registers a handler for every JSON text message, decoded as
+// described at Message.
+func (c *Client) OnMessage(handler func(msg Message)) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.messageHandlers = append(c.messageHandlers, handler)
+}
+
+// OnText registers a handler for text messages that are neither JSON nor
+// the server's handshake line.
+func (c *Client) OnText(handler func(text string)) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.textHandlers = append(c.textHandlers, handler)
+}
+
+// OnRaw registers a handler seeing every message as received, before it is
+// decoded.
+func (c *Client) OnRaw(handler func(messageType int, data []byte)) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.rawHandlers = append(c.rawHandlers, handler)
+}
+
+// OnSend registers a handler for every text message the client sends, in
+// the form it goes out; sent is false for one WithDryRun dropped.
+func (c *Client) OnSend(handler func(message []byte, sent bool)) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.sendHandlers = append(c.sendHandlers, handler)
+}
+
+// OnControlLatency registers a handler for the round trip of each control
+// message, such as a dspcontrol: the time from sending it to the server
+// having read it. OpenWebRX doesn't acknowledge them, so every one is
+// followed by a ping, which the server can only answer once it has read
+// what came before.
+func (c *Client) OnControlLatency(handler func(rtt time.Duration)) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.latencyHandlers = append(c.latencyHandlers, handler)
+}
+
+// OnError registers a handler for errors that happen while connected but
+// don't end the connection, such as an undecodable frame.
+func (c *Client) OnError(handler func(err error)) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.errorHandlers = append(c.errorHandlers, handler)
+}
+
+// Connect dials the server and starts receiving: it performs the
+// handshake, selects the profile, applies the demodulator setup and starts
+// the audio. ctx bounds the dial only. The connection lasts until the
+// server closes it, it fails or Close is called; Done tells when.
+func (c *Client) Connect(ctx context.Context) error {
+	if c.optionErr != nil {
+		return c.optionErr
+	}
+
+	if c.connectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.connectTimeout)
+		defer cancel()
+	}
+
+	dialer := *websocket.DefaultDialer
+	dialer.HandshakeTimeout = c.connectTimeout
+	dialer.TLSClientConfig = c.tlsConfig
+	conn, _, err := dialer.DialContext(ctx, c.URL(), c.header)
+	if err != nil {
+		if isTimeout(err) {
+			return fmt.Errorf("timed out after %v connecting to %s", c.connectTimeout, c.addr)
+		}
+		return err
+	}
+
+	done := make(chan struct{})
+	c.mu.Lock()
+	c.conn, c.done, c.err, c.closeErr, c.backoff = conn, done, nil, nil, 0
+	c.handshake = HandshakeMessage{}
+	c.failing = make(map[byte]bool)
+	c.probes = make(map[string]time.Time)
+	c.mu.Unlock()
+
+	c.handlersMu.Lock()
+	c.audioStarted = false
+	c.handlersMu.Unlock()
+
+	c.audio.mu.Lock()
+	c.audio.rate, c.audio.hdRate = c.outputRate, c.hdOutputRate
+	if c.audio.compression == "" {
+		c.audio.compression = defaultAudioCompression
+	}
+	c.audio.mu.Unlock()
+	if err := c.audio.reset(); err != nil {
+		c.reportError(err)
+	}
+
+	c.startKeepalive(conn, done)
+	go c.read(conn, done)
+
+	if err := c.initialize(); err != nil {
+		// The server may have hung up right after telling why, e.g. with a
+		// backoff message, so give the reader a chance to get to it.
+		select {
+		case <-done:
+		case <-time.After(closeTimeout):
+		}
+		conn.Close()
+		return err
+	}
+	return nil
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (c *Client) initialize() error {
+	if err := c.send("SERVER DE CLIENT client=openwebrx.js type=receiver", false); err != nil {
+		return err
+	}
+
+	properties := map[string]interface{}{
+		"hd_output_rate": c.hdOutputRate,
+		"output_rate":    c.outputRate,
+	}
+	if compression := PreferredAudioCompression(); compression != defaultAudioCompression {
+		properties["audio_compression"] = compression
+	}
+	if err := c.send(map[string]interface{}{
+		"params": properties,
+		"type":   "connectionproperties",
+	}, false); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	profile := c.profile
+	c.mu.Unlock()
+	if profile != "" {
+		if err := c.sendProfile(profile); err != nil {
+			return err
+		}
+	}
+
+	if err := c.sendDSP(c.DSP()); err != nil {
+		return err
+	}
+	return c.Send(map[string]interface{}{
+		"type":   "dspcontrol",
+		"action": "start",
+	})
+}
+
+// Connected reports whether there is a connection.
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.conn != nil
+}
+
+// Done returns a channel closed when the last connection ends.
+func (c *Client) Done() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.done
+}
+
+// Err returns the error that ended the last connection, a
+// *websocket.CloseError if the server closed it.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// Close sends a close frame and waits, at most two seconds, for the server
+// to acknowledge it before dropping the connection. As it waits for the
+// reader, it must not be called from a handler.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	conn, done := c.conn, c.done
+	c.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+
+	c.writeMu.Lock()
+	err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	c.writeMu.Unlock()
+	if err == nil {
+		select {
+		case <-done:
+		case <-time.After(closeTimeout):
+		}
+	}
+	conn.Close()
+	return err
+}
+
+// Send sends a text message: a string as is, anything else as JSON. With
+// WithDryRun it sends nothing and returns nil.
+func (c *Client) Send(message interface{}) error {
+	return c.send(message, true)
+}
+
+// send sends a message, unless it is a control message in a dry run.
+func (c *Client) send(message interface{}, control bool) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	var msg []byte
+	switch m := message.(type) {
+	case string:
+		msg = []byte(m)
+	default:
+		var err error
+		if msg, err = json.Marshal(m); err != nil {
+			return fmt.Errorf("marshalling JSON: %v", err)
+		}
+	}
+
+	sent := !(control && c.dryRun)
+	c.handlersMu.Lock()
+	handlers := c.sendHandlers
+	c.handlersMu.Unlock()
+	for _, handler := range handlers {
+		handler(msg, sent)
+	}
+	if !sent {
+		return nil
+	}
+
+	c.writeMu.Lock()
+	sentAt := time.Now()
+	err := conn.WriteMessage(websocket.TextMessage, msg)
+	c.writeMu.Unlock()
+	if err == nil && control {
+		c.probeLatency(conn, sentAt)
+	}
+	return err
+}
+
+// probeLatency pings the server after a control message sent at sentAt, to
+// time the message's round trip by the pong.
+func (c *Client) probeLatency(conn *websocket.Conn, sentAt time.Time) {
+	c.mu.Lock()
+	if c.conn != conn || len(c.probes) >= maxLatencyProbes {
+		c.mu.Unlock()
+		return
+	}
+	c.probeSeq++
+	id := fmt.Sprintf("%s%d", latencyProbePrefix, c.probeSeq)
+	c.probes[id] = sentAt
+	c.mu.Unlock()
+
+	if err := conn.WriteControl(websocket.PingMessage, []byte(id), time.Now().Add(c.pingTimeout)); err != nil {
+		c.mu.Lock()
+		delete(c.probes, id)
+		c.mu.Unlock()
+	}
+}
+
+// handlePong reports the round trip of the control message a pong answers.
+func (c *Client) handlePong(data string) {
+	if !strings.HasPrefix(data, latencyProbePrefix) {
+		return
+	}
+	c.mu.Lock()
+	sentAt, ok := c.probes[data]
+	delete(c.probes, data)
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	rtt := time.Since(sentAt)
+	c.handlersMu.Lock()
+	handlers := c.latencyHandlers
+	c.handlersMu.Unlock()
+	for _, handler := range handlers {
+		handler(rtt)
+	}
+}
+
+// SelectProfile switches to the server's SDR profile id, given as
+// "sdr|profile". The choice is kept for later connections.
+func (c *Client) SelectProfile(id string) error {
+	c.mu.Lock()
+	c.profile = id
+	c.mu.Unlock()
+
+	if !c.Connected() {
+		return nil
+	}
+	return c.sendProfile(id)
+}
+
+func (c *Client) sendProfile(id string) error {
+	return c.Send(map[string]interface{}{
+		"params": map[string]interface{}{"profile": id},
+		"type":   "selectprofile",
+	})
+}
+
+// Handshake returns the server's handshake line of the current connection,
+// zero until it has been received. See CheckServerVersion.
+func (c *Client) Handshake() HandshakeMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.handshake
+}
+
+// Band returns the center frequency and sample rate of the active profile,
+// zero until the server has sent them.
+func (c *Client) Band() (centerFreq, sampleRate int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.centerFreq, c.sampleRate
+}
+
+func (c *Client) read(conn *websocket.Conn, done chan struct{}) {
+	defer close(done)
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			c.mu.Lock()
+			c.err, c.closeErr = err, err
+			if c.conn == conn {
+				c.conn = nil
+			}
+			c.mu.Unlock()
+			conn.Close()
+			return
+		}
+		c.dispatch(messageType, data)
+	}
+}
+
+// Feed handles a message as if the server had sent it, for replaying a
+// recorded session without a connection. The handlers run on the caller's
+// goroutine.
+func (c *Client) Feed(messageType int, data []byte) {
+	c.dispatch(messageType, data)
+}
+
+// FeedAudio passes a decoded audio frame to the audio handlers as if it had
+// been received, e.g. when replaying a recording.
+func (c *Client) FeedAudio(frame AudioFrame) {
+	c.deliverAudio(frame)
+}
+
+// FeedFFT passes a decoded FFT line to the FFT handlers as if it had been
+// received.
+func (c *Client) FeedFFT(bins []float32) {
+	c.handlersMu.Lock()
+	handlers := c.fftHandlers
+	c.handlersMu.Unlock()
+	for _, handler := range handlers {
+		handler(bins)
+	}
+}
+
+func (c *Client) dispatch(messageType int, data []byte) {
+	c.handlersMu.Lock()
+	raw := c.rawHandlers
+	c.handlersMu.Unlock()
+	for _, handler := range raw {
+		handler(messageType, data)
+	}
+
+	switch messageType {
+	case websocket.BinaryMessage:
+		c.handleBinary(data)
+	case websocket.TextMessage:
+		c.handleText(data)
+	}
+}
+
+func (c *Client) handleBinary(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	if len(data) == 1 && data[0] != 3 {
+		c.frameFailed(data[0], fmt.Errorf("%w: type %d message without a payload", ErrMalformedFrame, data[0]))
+		return
+	}
+
+	switch data[0] {
+	case 1:
+		c.handleFFT(data[1:])
+	case 2:
+		c.handleAudio(data[1:], false)
+	case 3:
+		c.handleSecondaryFFT(data[1:])
+	case 4:
+		c.handleAudio(data[1:], true)
+	}
+}
+
+func (c *Client) handleAudio(data []byte, hd bool) {
+	kind := byte(2)
+	if hd {
+		kind = 4
+	}
+	frame, err := c.audio.decode(data, hd)
+	if err != nil {
+		c.frameFailed(kind, err)
+		return
+	}
+	c.frameDecoded(kind)
+	if len(frame.Samples) > 0 {
+		c.deliverAudio(frame)
+	}
+}
+
+// frameFailed reports a binary message of type kind that couldn't be
+// decoded, unless the one before it failed too: the rest of a run, e.g.
+// of a compression this build can't decode, would fail the same way.
+func (c *Client) frameFailed(kind byte, err error) {
+	c.mu.Lock()
+	report := !c.failing[kind]
+	if c.failing == nil {
+		c.failing = make(map[byte]bool)
+	}
+	c.failing[kind] = true
+	c.mu.Unlock()
+	if report {
+		c.reportError(err)
+	}
+}
+
+// frameDecoded ends a run of failures of type kind.
+func (c *Client) frameDecoded(kind byte) {
+	c.mu.Lock()
+	delete(c.failing, kind)
+	c.mu.Unlock()
+}
+
+func (c *Client) deliverAudio(frame AudioFrame) {
+	c.handlersMu.Lock()
+	handlers := c.audioHandlers
+	if len(handlers) == 0 {
+		c.holdAudio(frame)
+		c.handlersMu.Unlock()
+		return
+	}
+	frames := append(c.heldAudio, frame)
+	c.heldAudio = nil
+	started := c.audioStarted
+	c.audioStarted = true
+	c.handlersMu.Unlock()
+
+	if !started {
+		c.notify(Status{State: StateAudioStarted, Held: len(frames) - 1})
+	}
+	for _, frame := range frames {
+		for _, handler := range handlers {
+			handler(frame)
+		}
+	}
+}
+
+// holdAudio keeps a frame for the first audio handler, dropping the oldest
+// ones beyond maxHeldAudio. handlersMu must be held.
+func (c *Client) holdAudio(frame AudioFrame) {
+	c.heldAudio = append(c.heldAudio, frame)
+
+	var held time.Duration
+	for _, f := range c.heldAudio {
+		held += f.duration()
+	}
+	for held > maxHeldAudio && len(c.heldAudio) > 1 {
+		held -= c.heldAudio[0].duration()
+		c.heldAudio = c.heldAudio[1:]
+	}
+}
+
+// handleFFT decodes and passes on an FFT frame. A frame with fewer bins
+// than the fft_size of the profile is skipped; an ADPCM one may have a bin
+// more, as the codec packs two to a byte, which is cut off.
+func (c *Client) handleFFT(data []byte) {
+	c.handlersMu.Lock()
+	handlers := c.fftHandlers
+	c.handlersMu.Unlock()
+	if len(handlers) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	compression, size := c.fftCompression, c.fftSize
+	c.mu.Unlock()
+
+	bins, err := decodeFFTFrame(data, compression, size, "the profile has")
+	if err != nil {
+		c.frameFailed(1, fmt.Errorf("decoding FFT data: %w", err))
+		return
+	}
+	c.frameDecoded(1)
+
+	for _, handler := range handlers {
+		handler(bins)
+	}
+}
+
+// handleSecondaryFFT decodes the secondary demodulator's FFT, which the
+// server compresses like the main one. An empty message carries nothing
+// to decode.
+func (c *Client) handleSecondaryFFT(data []byte) {
+	c.handlersMu.Lock()
+	handlers := c.secondaryFFTs
+	c.handlersMu.Unlock()
+	if len(handlers) == 0 || len(data) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	compression, size := c.fftCompression, c.secondaryFFT
+	c.mu.Unlock()
+
+	bins, err := decodeFFTFrame(data, compression, size, "secondary_fft_size is")
+	if err != nil {
+		c.frameFailed(3, fmt.Errorf("decoding secondary FFT data: %w", err))
+		return
+	}
+	c.frameDecoded(3)
+
+	for _, handler := range handlers {
+		handler(bins)
+	}
+}
+
+// decodeFFTFrame decodes an FFT frame and checks it against the size the
+// server announced, where it did. An ADPCM frame may carry a bin more than
+// that, as the codec packs two values to a byte, which is cut off.
+func decodeFFTFrame(data []byte, compression string, size int, expected string) ([]float32, error) {
+	bins, err := DecodeFFT(data, compression)
+	switch {
+	case err != nil:
+		return nil, err
+	case size > 0 && len(bins) < size,
+		size > 0 && len(bins) > size && compression != "adpcm":
+		return nil, fmt.Errorf("%w: %d bins, %s %d", ErrMalformedFrame, len(bins), expected, size)
+	case size > 0:
+		bins = bins[:size]
+	}
+	return bins, nil
+}
+
+func (c *Client) handleText(data []byte) {
+	if handshake, ok := parseHandshake(string(data)); ok {
+		c.mu.Lock()
+		c.handshake = *handshake
+		c.mu.Unlock()
+		c.dispatchMessage(handshake)
+		return
+	}
+
+	if !isObject(data) {
+		c.handlersMu.Lock()
+		handlers := c.textHandlers
+		c.handlersMu.Unlock()
+		for _, handler := range handlers {
+			handler(string(data))
+		}
+		return
+	}
+
+	msg, err := DecodeMessage(data)
+	if err != nil {
+		c.reportError(err)
+		return
+	}
+
+	switch m := msg.(type) {
+	case *BackoffMessage:
+		c.handleBackoff(m)
+	case *ConfigMessage:
+		c.handleConfig(m.Value)
+	case *SecondaryConfigMessage:
+		c.mu.Lock()
+		c.secondaryFFT = m.Value.FFTSize
+		delete(c.failing, 3)
+		c.mu.Unlock()
+	case *SmeterMessage:
+		c.handlersMu.Lock()
+		handlers := c.smeterHandlers
+		c.handlersMu.Unlock()
+		for _, handler := range handlers {
+			handler(m.Value)
+		}
+	}
+
+	c.dispatchMessage(msg)
+}
+
+func (c *Client) dispatchMessage(msg Message) {
+	c.handlersMu.Lock()
+	handlers := c.messageHandlers
+	c.handlersMu.Unlock()
+	for _, handler := range handlers {
+		handler(msg)
+	}
+}
+
+// isObject reports whether data is a JSON object, as every message but the
+// handshake line is.
+func isObject(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '{' && json.Valid(data)
+}
+
+// handleConfig picks up what the client itself needs from a config
+// message: the band for SetFrequency and how the streams are compressed.
+func (c *Client) handleConfig(config Config) {
+	c.mu.Lock()
+	if config.CenterFreq != nil {
+		c.centerFreq = *config.CenterFreq
+	}
+	if config.SampleRate != nil {
+		c.sampleRate = *config.SampleRate
+	}
+	if config.FFTSize != nil {
+		c.fftSize = *config.FFTSize
+	}
+	if config.FFTCompression != nil {
+		c.fftCompression = *config.FFTCompression
+		delete(c.failing, 1)
+		delete(c.failing, 3)
+	}
+	c.mu.Unlock()
+
+	if config.AudioCompression != nil {
+		if err := c.audio.setCompression(*config.AudioCompression); err != nil {
+			c.reportError(err)
+		}
+	}
+}
+
+func (c *Client) reportError(err error) {
+	c.handlersMu.Lock()
+	handlers := c.errorHandlers
+	c.handlersMu.Unlock()
+	for _, handler := range handlers {
+		handler(err)
+	}
+}
+
+// startKeepalive pings the server every ping interval. Each pong pushes the
+// read deadline out again, so a connection that stops answering fails its
+// next read.
+func (c *Client) startKeepalive(conn *websocket.Conn, done chan struct{}) {
+	interval, timeout := c.pingInterval, c.pingTimeout
+	if interval <= 0 {
+		conn.SetPongHandler(func(data string) error {
+			c.handlePong(data)
+			return nil
+		})
+		return
+	}
+
+	deadline := func() time.Time {
+		return time.Now().Add(interval + timeout)
+	}
+
+	conn.SetReadDeadline(deadline())
+	conn.SetPongHandler(func(data string) error {
+		c.handlePong(data)
+		return conn.SetReadDeadline(deadline())
+	})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(timeout)); err != nil {
+					c.reportError(fmt.Errorf("sending ping: %v", err))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,332 @@
+package owrx
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"net.wadon/owrxp-playground/owrx/owrxtest"
+)
+
+const testTimeout = 2 * time.Second
+
+// connect connects a client with opts to a fresh test server and returns
+// the server's end of the connection.
+func connect(t *testing.T, opts ...Option) (*Client, *owrxtest.Conn) {
+	t.Helper()
+
+	srv := owrxtest.NewServer()
+	t.Cleanup(srv.Close)
+
+	c := NewClient(srv.Addr(), opts...)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	conn, err := srv.Accept(testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, conn
+}
+
+func TestHandshake(t *testing.T) {
+	c, conn := connect(t, WithOutputRates(12000, 48000), WithMode("usb"), WithOffset(-12500), WithSquelch(-80))
+	smeter := make(chan float64, 1)
+	c.OnSmeter(func(value float64) { smeter <- value })
+
+	props, err := conn.Expect("connectionproperties", testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props["output_rate"] != 12000.0 || props["hd_output_rate"] != 48000.0 {
+		t.Errorf("connectionproperties %v, want output_rate 12000 and hd_output_rate 48000", props)
+	}
+
+	params, err := conn.Expect("dspcontrol", testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usb, _ := FindMode("usb")
+	for key, want := range map[string]interface{}{
+		"mod":           "usb",
+		"offset_freq":   -12500.0,
+		"squelch_level": -80.0,
+		"low_cut":       float64(usb.LowCut),
+		"high_cut":      float64(usb.HighCut),
+	} {
+		if params[key] != want {
+			t.Errorf("dspcontrol %s = %v, want %v", key, params[key], want)
+		}
+	}
+
+	// Messages are handled in order, so by the time a smeter reading sent
+	// now arrives the banner has been.
+	if err := conn.SendSmeter(1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-smeter:
+	case <-time.After(testTimeout):
+		t.Fatal("no smeter reading")
+	}
+	if got := c.Handshake().Version; got != "1.2.2" {
+		t.Errorf("handshake version %q, want the server's 1.2.2", got)
+	}
+}
+
+func TestSmeterDispatch(t *testing.T) {
+	c, conn := connect(t)
+	got := make(chan float64, 1)
+	c.OnSmeter(func(value float64) { got <- value })
+
+	if err := conn.SendSmeter(0.25); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case value := <-got:
+		if value != 0.25 {
+			t.Errorf("smeter %v, want 0.25", value)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("no smeter reading")
+	}
+}
+
+func TestAudioDispatch(t *testing.T) {
+	c, conn := connect(t, WithOutputRates(12000, 48000))
+	got := make(chan AudioFrame, 2)
+	c.OnAudio(func(frame AudioFrame) { got <- frame })
+
+	samples := []int16{0, 1000, -1000, 32767, -32768}
+	if err := conn.SendAudio(samples, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SendAudio(samples, true); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []AudioFrame{{Samples: samples, Rate: 12000}, {Samples: samples, Rate: 48000, HD: true}} {
+		select {
+		case frame := <-got:
+			if !reflect.DeepEqual(frame, want) {
+				t.Errorf("audio frame %+v, want %+v", frame, want)
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("no audio frame")
+		}
+	}
+}
+
+func TestFFTDispatch(t *testing.T) {
+	c, conn := connect(t)
+	got := make(chan []float32, 1)
+	c.OnFFT(func(bins []float32) { got <- bins })
+
+	bins := []float32{-120, -95.5, -60, -110}
+	if err := conn.SendFFT(bins); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-got:
+		if !reflect.DeepEqual(line, bins) {
+			t.Errorf("FFT %v, want %v", line, bins)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("no FFT line")
+	}
+}
+
+// TestReconnectAfterClose checks the close code sets the delay of the first
+// retry only, and later failed attempts back off as usual.
+func TestReconnectAfterClose(t *testing.T) {
+	const base, max = 20 * time.Millisecond, 200 * time.Millisecond
+
+	srv := owrxtest.NewServer()
+	c := NewClient(srv.Addr(), WithReconnect(base, max), WithConnectTimeout(time.Second))
+	delays := make(chan time.Duration, 8)
+	c.OnStatus(func(status Status) {
+		if status.State == StateWaiting {
+			delays <- status.Delay
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+
+	conn, err := srv.Accept(testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stopping the server with the close frame leaves the next attempts
+	// nothing to connect to.
+	conn.Close(websocket.CloseTryAgainLater, "busy")
+	srv.Close()
+
+	for _, want := range []time.Duration{max, 2 * base, 4 * base} {
+		select {
+		case delay := <-delays:
+			if delay != want {
+				t.Errorf("reconnect delay %v, want %v", delay, want)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("no reconnect waiting %v", want)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run returned %v after its context was cancelled", err)
+	}
+}
+
+func TestNoReconnectAfterPolicyViolation(t *testing.T) {
+	srv := owrxtest.NewServer()
+	defer srv.Close()
+	c := NewClient(srv.Addr(), WithReconnect(10*time.Millisecond, 100*time.Millisecond))
+
+	done := make(chan error, 1)
+	go func() { done <- c.Run(context.Background()) }()
+
+	conn, err := srv.Accept(testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close(websocket.ClosePolicyViolation, "banned")
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Run returned nil, want an error for close code 1008")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Run kept reconnecting after close code 1008")
+	}
+	if n := srv.Connections(); n != 1 {
+		t.Errorf("%d connections, want 1", n)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	const base, max = time.Second, 30 * time.Second
+	c := NewClient("localhost:1", WithReconnect(base, max))
+
+	for _, tc := range []struct {
+		code  int
+		delay time.Duration
+	}{
+		{websocket.CloseServiceRestart, base},
+		{websocket.CloseGoingAway, base},
+		{websocket.CloseTryAgainLater, max},
+		{websocket.CloseAbnormalClosure, 2 * base},
+		{websocket.CloseNormalClosure, 2 * base},
+	} {
+		c.closeErr = &websocket.CloseError{Code: tc.code}
+		delay, err := c.retryDelay(2)
+		if err != nil || delay != tc.delay {
+			t.Errorf("close code %d: retryDelay = %v, %v, want %v", tc.code, delay, err, tc.delay)
+		}
+		if delay, _ := c.retryDelay(3); delay != 4*base {
+			t.Errorf("close code %d: second retryDelay = %v, want the backoff %v", tc.code, delay, 4*base)
+		}
+	}
+
+	c.closeErr = &websocket.CloseError{Code: websocket.CloseProtocolError}
+	if _, err := c.retryDelay(1); err == nil {
+		t.Error("close code 1002: retryDelay succeeded, want an error")
+	}
+
+	c.backoff = 5 * time.Second
+	c.closeErr = &websocket.CloseError{Code: websocket.CloseServiceRestart}
+	if delay, _ := c.retryDelay(1); delay != 5*time.Second {
+		t.Errorf("with a backoff message: retryDelay = %v, want 5s", delay)
+	}
+}
+
+func TestDecodeFFTFrame(t *testing.T) {
+	float32s := func(n int) []byte { return make([]byte, 4*n) }
+
+	for _, tc := range []struct {
+		name        string
+		data        []byte
+		compression string
+		size        int
+		bins        int
+	}{
+		{"whole line", float32s(4), "none", 4, 4},
+		{"size unknown", float32s(3), "none", 0, 3},
+		{"short line", float32s(3), "none", 4, -1},
+		{"long line", float32s(5), "none", 4, -1},
+		{"odd length", float32s(4)[:15], "none", 4, -1},
+		{"empty", nil, "none", 4, -1},
+		{"adpcm extra bin cut off", make([]byte, 8), "adpcm", 5, 5},
+		{"adpcm short", make([]byte, 8), "adpcm", 8, -1},
+		{"adpcm padding only", make([]byte, 5), "adpcm", 0, -1},
+	} {
+		bins, err := decodeFFTFrame(tc.data, tc.compression, tc.size, "the profile has")
+		switch {
+		case tc.bins < 0 && !errors.Is(err, ErrMalformedFrame):
+			t.Errorf("%s: got %d bins, %v, want ErrMalformedFrame", tc.name, len(bins), err)
+		case tc.bins >= 0 && (err != nil || len(bins) != tc.bins):
+			t.Errorf("%s: got %d bins, %v, want %d", tc.name, len(bins), err, tc.bins)
+		}
+	}
+}
+
+// TestMalformedFrames feeds two runs of bad binary messages between good
+// FFT lines: each run is reported once and skipped, and the next good line
+// gets through unchanged. Bad audio isn't followed by good audio, so both
+// runs of it count as one.
+func TestMalformedFrames(t *testing.T) {
+	line := make([]byte, 1+4*4)
+	line[0] = 1
+
+	for _, tc := range []struct {
+		name   string
+		bad    [][]byte
+		errors int
+	}{
+		{"short", [][]byte{line[:9], line[:9]}, 2},
+		{"odd length", [][]byte{line[:len(line)-1]}, 2},
+		{"header only", [][]byte{{1}, {1}, {1}}, 2},
+		{"mixed", [][]byte{{1}, line[:5], line[:len(line)-1]}, 2},
+		{"empty", [][]byte{{}}, 0},
+		{"header only audio", [][]byte{{2}, {4}}, 2},
+	} {
+		c := NewClient("localhost:1")
+		c.Feed(websocket.TextMessage, []byte(`{"type":"config","value":{"fft_size":4,"fft_compression":"none"}}`))
+		var errs []error
+		c.OnError(func(err error) { errs = append(errs, err) })
+		var lines int
+		c.OnFFT(func(bins []float32) { lines++ })
+
+		for round := 0; round < 2; round++ {
+			c.Feed(websocket.BinaryMessage, line)
+			for _, frame := range tc.bad {
+				c.Feed(websocket.BinaryMessage, frame)
+			}
+		}
+		c.Feed(websocket.BinaryMessage, line)
+
+		if lines != 3 {
+			t.Errorf("%s: %d good FFT lines handled, want 3", tc.name, lines)
+		}
+		if len(errs) != tc.errors {
+			t.Errorf("%s: %d errors reported, want %d: %v", tc.name, len(errs), tc.errors, errs)
+		}
+		for _, err := range errs {
+			if !errors.Is(err, ErrMalformedFrame) {
+				t.Errorf("%s: error %v doesn't wrap ErrMalformedFrame", tc.name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package owrx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// AudioCodec decodes the payload of a single audio frame into PCM.
+type AudioCodec interface {
+	Decode(data []byte) ([]int16, error)
+}
+
+// audioCodecs maps the server's audio_compression setting to a codec
+// constructor. The argument is the negotiated output rate of the stream.
+var audioCodecs = map[string]func(rate int) (AudioCodec, error){
+	"adpcm": func(int) (AudioCodec, error) { return &adpcmCodec{}, nil },
+	"none":  func(int) (AudioCodec, error) { return &pcmCodec{}, nil },
+}
+
+const defaultAudioCompression = "adpcm"
+
+// PreferredAudioCompression is the compression requested from the server:
+// Opus when this build can decode it, ADPCM otherwise.
+func PreferredAudioCompression() string {
+	if _, ok := audioCodecs["opus"]; ok {
+		return "opus"
+	}
+	return defaultAudioCompression
+}
+
+// newAudioCodec returns a decoder for compression. If there is none, or it
+// fails to start, it falls back to ADPCM and says so in the error.
+func newAudioCodec(compression string, rate int) (AudioCodec, error) {
+	newCodec, ok := audioCodecs[compression]
+	if !ok {
+		codec, _ := audioCodecs[defaultAudioCompression](rate)
+		return codec, fmt.Errorf("unsupported audio compression %q, falling back to %s (supported: %v)", compression, defaultAudioCompression, SupportedAudioCompressions())
+	}
+
+	codec, err := newCodec(rate)
+	if err != nil {
+		codec, _ = audioCodecs[defaultAudioCompression](rate)
+		return codec, fmt.Errorf("failed to set up %s decoder: %v, falling back to %s", compression, err, defaultAudioCompression)
+	}
+	return codec, nil
+}
+
+// SupportedAudioCompressions lists the audio_compression settings this
+// build can decode.
+func SupportedAudioCompressions() []string {
+	names := make([]string, 0, len(audioCodecs))
+	for name := range audioCodecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// codecRate returns the sample rate of the codec's output. Codecs that
+// can't produce the negotiated rate report their own via SampleRate.
+func codecRate(codec AudioCodec, rate int) int {
+	if r, ok := codec.(interface{ SampleRate() int }); ok {
+		return r.SampleRate()
+	}
+	return rate
+}
+
+type adpcmCodec struct {
+	state ADPCMState
+}
+
+func (c *adpcmCodec) Decode(data []byte) ([]int16, error) {
+	return decodeADPCM(data, &c.state), nil
+}
+
+// pcmCodec handles uncompressed audio, sent as little-endian int16. A
+// frame ending in half a sample has it completed by the next one.
+type pcmCodec struct {
+	partial []byte
+}
+
+func (c *pcmCodec) Decode(data []byte) ([]int16, error) {
+	if len(c.partial) > 0 {
+		data = append(c.partial, data...)
+		c.partial = nil
+	}
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	if len(data)%2 != 0 {
+		c.partial = []byte{data[len(data)-1]}
+	}
+	return samples, nil
+}
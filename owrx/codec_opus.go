@@ -0,0 +1,60 @@
+//go:build opus
+// +build opus
+
+package owrx
+
+import "gopkg.in/hraban/opus.v2"
+
+// Opus decoding needs libopus and is only compiled in with the opus build
+// tag, e.g. go build -tags "opus nolibopusfile".
+
+func init() {
+	audioCodecs["opus"] = newOpusCodec
+}
+
+var opusRates = []int{8000, 12000, 16000, 24000, 48000}
+
+// opusMaxFrame is the longest Opus frame, 120ms, in samples at 48 kHz.
+const opusMaxFrame = 5760
+
+type opusCodec struct {
+	decoder *opus.Decoder
+	rate    int
+	pcm     []int16
+}
+
+func newOpusCodec(rate int) (AudioCodec, error) {
+	decoderRate := opusRates[len(opusRates)-1]
+	for _, r := range opusRates {
+		if r >= rate {
+			decoderRate = r
+			break
+		}
+	}
+
+	decoder, err := opus.NewDecoder(decoderRate, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &opusCodec{
+		decoder: decoder,
+		rate:    decoderRate,
+		pcm:     make([]int16, opusMaxFrame),
+	}, nil
+}
+
+func (c *opusCodec) Decode(data []byte) ([]int16, error) {
+	n, err := c.decoder.Decode(data, c.pcm)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]int16, n)
+	copy(samples, c.pcm[:n])
+	return samples, nil
+}
+
+func (c *opusCodec) SampleRate() int {
+	return c.rate
+}
@@ -0,0 +1,50 @@
+package owrx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPCMCodec(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		frames [][]byte
+		want   [][]int16
+	}{
+		{"whole samples", [][]byte{{0x01, 0x00, 0xff, 0xff}}, [][]int16{{1, -1}}},
+		{"header only", [][]byte{{}, {0x02, 0x00}}, [][]int16{{}, {2}}},
+		{"half a sample", [][]byte{{0x03}}, [][]int16{{}}},
+		{"split mid-sample", [][]byte{{0x01, 0x00, 0x02}, {0x00, 0x03, 0x00}}, [][]int16{{1}, {2, 3}}},
+		{"split twice", [][]byte{{0x01}, {0x00, 0x02}, {0x00}}, [][]int16{{}, {1}, {2}}},
+	} {
+		codec := &pcmCodec{}
+		for i, frame := range tc.frames {
+			samples, err := codec.Decode(frame)
+			if err != nil {
+				t.Fatalf("%s: frame %d: %v", tc.name, i, err)
+			}
+			if !reflect.DeepEqual(samples, tc.want[i]) {
+				t.Errorf("%s: frame %d decoded to %v, want %v", tc.name, i, samples, tc.want[i])
+			}
+		}
+	}
+}
+
+// TestAudioDecoderReset checks half a sample left by one connection isn't
+// joined to the first frame of the next.
+func TestAudioDecoderReset(t *testing.T) {
+	d := audioDecoder{compression: "none", rate: 12000}
+	if _, err := d.decode([]byte{0x01, 0x00, 0x02}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.reset(); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := d.decode([]byte{0x05, 0x00}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(frame.Samples, []int16{5}) {
+		t.Errorf("first frame after reset decoded to %v, want [5]", frame.Samples)
+	}
+}
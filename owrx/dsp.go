@@ -0,0 +1,237 @@
+package owrx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DSP is the demodulator setup applied with dspcontrol. The client keeps
+// it across connections, so a reconnect doesn't fall back to the server's
+// defaults.
+type DSP struct {
+	Mod            string
+	LowCut         int
+	HighCut        int
+	OffsetFreq     int
+	SquelchLevel   int
+	DMRFilter      int
+	AudioServiceID int
+	SecondaryMod   string
+	// CTCSSTone is the tone in Hz the squelch waits for, 0 for none.
+	CTCSSTone float64
+	// ctcssUsed is set once a tone has been, so clearing it is sent too.
+	ctcssUsed bool
+	// NoiseReduction and NRThreshold, its strength in dB, are only sent
+	// with NRAvailable set, which is up to the caller to do once the
+	// server has said it supports noise reduction.
+	NRAvailable    bool
+	NoiseReduction bool
+	NRThreshold    int
+	// AutoNotch lets the server find and notch out carriers itself, and
+	// NotchFreqs are audio frequencies in Hz to notch out in any case.
+	AutoNotch  bool
+	NotchFreqs []int
+	// AGC is one of AGCModes, or empty to leave the server's AGC as it is.
+	// Gain is the fixed gain in dB used with the AGC off.
+	AGC  string
+	Gain float64
+}
+
+// AGCModes are the AGC settings that can be asked for.
+var AGCModes = []string{"fast", "slow", "off"}
+
+// ValidAGC reports whether mode is one of AGCModes.
+func ValidAGC(mode string) bool {
+	for _, m := range AGCModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// DSP.DMRFilter is a bitmask of the DMR timeslots whose voice is passed on
+// to the audio. A DMR channel carries two calls at once, one in each
+// timeslot: bit 0 selects timeslot 1 and bit 1 timeslot 2.
+const (
+	DMRTimeslot1     = 1 << 0
+	DMRTimeslot2     = 1 << 1
+	DMRBothTimeslots = DMRTimeslot1 | DMRTimeslot2
+)
+
+// DMRFilterPresets name the DMR filter values; "all" unmutes every
+// timeslot, the same as "both".
+var DMRFilterPresets = map[string]int{
+	"both": DMRBothTimeslots,
+	"all":  DMRBothTimeslots,
+	"ts1":  DMRTimeslot1,
+	"ts2":  DMRTimeslot2,
+}
+
+// ParseDMRFilter reads a DMR filter given by its preset name, in any case,
+// or as the bitmask, 1 to 3.
+func ParseDMRFilter(value string) (int, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if filter, ok := DMRFilterPresets[value]; ok {
+		return filter, nil
+	}
+	filter, err := strconv.Atoi(value)
+	if err != nil || filter < DMRTimeslot1 || filter > DMRBothTimeslots {
+		return 0, fmt.Errorf("unknown DMR filter %q, use both, all, ts1, ts2 or 1 to 3", value)
+	}
+	return filter, nil
+}
+
+// DMRFilterName is the preset name of a DMR filter value.
+func DMRFilterName(filter int) string {
+	switch filter {
+	case DMRTimeslot1:
+		return "ts1"
+	case DMRTimeslot2:
+		return "ts2"
+	case DMRBothTimeslots:
+		return "both"
+	}
+	return strconv.Itoa(filter)
+}
+
+// SetMode switches to mode. The passband follows the mode unless it was
+// changed from the default of the current one.
+func (d *DSP) SetMode(mode Mode) {
+	if current, ok := FindMode(d.Mod); !ok || (d.LowCut == current.LowCut && d.HighCut == current.HighCut) {
+		d.LowCut = mode.LowCut
+		d.HighCut = mode.HighCut
+	}
+	d.Mod = mode.Name
+}
+
+// Params returns the parameters of the dspcontrol message applying d.
+func (d DSP) Params() map[string]interface{} {
+	var secondary interface{} = false
+	if d.SecondaryMod != "" {
+		secondary = d.SecondaryMod
+	}
+
+	params := map[string]interface{}{
+		"audio_service_id": d.AudioServiceID,
+		"dmr_filter":       d.DMRFilter,
+		"high_cut":         d.HighCut,
+		"low_cut":          d.LowCut,
+		"mod":              d.Mod,
+		"offset_freq":      d.OffsetFreq,
+		"secondary_mod":    secondary,
+		"squelch_level":    d.SquelchLevel,
+	}
+	// Only sent once a tone has been set, as servers without a tone
+	// squelch have no use for it; after that 0 clears it.
+	if d.CTCSSTone != 0 || d.ctcssUsed {
+		params["ctcss_tone"] = d.CTCSSTone
+	}
+	if d.AutoNotch || len(d.NotchFreqs) > 0 {
+		params["notch_auto"] = d.AutoNotch
+		params["notch_freqs"] = d.NotchFreqs
+	}
+	if d.AGC != "" {
+		params["agc"] = d.AGC
+		if d.AGC == "off" {
+			params["gain"] = d.Gain
+		}
+	}
+	if d.NRAvailable {
+		params["nr_enabled"] = d.NoiseReduction
+		params["nr_threshold"] = d.NRThreshold
+	}
+	return params
+}
+
+// DSP returns the current demodulator setup.
+func (c *Client) DSP() DSP {
+	c.dspMu.Lock()
+	defer c.dspMu.Unlock()
+
+	return c.dsp
+}
+
+// UpdateDSP applies change to the demodulator setup and sends the result
+// if connected. It returns the new setup; an error means only that it
+// couldn't be sent, the change is kept for the next connection.
+func (c *Client) UpdateDSP(change func(d *DSP)) (DSP, error) {
+	c.dspMu.Lock()
+	d := c.dsp
+	change(&d)
+	d.ctcssUsed = d.ctcssUsed || d.CTCSSTone != 0
+	c.dsp = d
+	c.dspMu.Unlock()
+
+	if !c.Connected() {
+		return d, nil
+	}
+	return d, c.sendDSP(d)
+}
+
+func (c *Client) sendDSP(d DSP) error {
+	return c.Send(map[string]interface{}{
+		"params": d.Params(),
+		"type":   "dspcontrol",
+	})
+}
+
+// SetMode switches the demodulator to the named mode.
+func (c *Client) SetMode(name string) error {
+	mode, ok := FindMode(name)
+	if !ok {
+		return fmt.Errorf("unknown mode %q", name)
+	}
+	_, err := c.UpdateDSP(func(d *DSP) {
+		d.SetMode(mode)
+	})
+	return err
+}
+
+// SetOffset tunes to offset Hz from the profile's center frequency.
+func (c *Client) SetOffset(offset int) error {
+	_, err := c.UpdateDSP(func(d *DSP) {
+		d.OffsetFreq = offset
+	})
+	return err
+}
+
+// SetFrequency tunes to an absolute frequency in Hz, which must lie within
+// the active profile.
+func (c *Client) SetFrequency(freq int64) error {
+	center, rate := c.Band()
+	if center == 0 {
+		return errors.New("the server hasn't sent its center frequency yet")
+	}
+	offset := freq - center
+	if half := rate / 2; rate > 0 && (offset < -half || offset > half) {
+		return fmt.Errorf("%d Hz is outside the profile, which covers %d to %d Hz", freq, center-half, center+half)
+	}
+	return c.SetOffset(int(offset))
+}
+
+// SetSquelch sets the squelch level in dB; -150 keeps it open.
+func (c *Client) SetSquelch(level int) error {
+	_, err := c.UpdateDSP(func(d *DSP) {
+		d.SquelchLevel = level
+	})
+	return err
+}
+
+// SetCTCSS makes the squelch open only on transmissions carrying tone, one
+// of CTCSSTones; 0 turns the tone squelch off.
+func (c *Client) SetCTCSS(tone float64) error {
+	if tone != 0 {
+		standard, ok := FindCTCSSTone(tone)
+		if !ok {
+			return fmt.Errorf("%g Hz is not a standard CTCSS tone", tone)
+		}
+		tone = standard
+	}
+	_, err := c.UpdateDSP(func(d *DSP) {
+		d.CTCSSTone = tone
+	})
+	return err
+}
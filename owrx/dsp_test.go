@@ -0,0 +1,32 @@
+package owrx
+
+import "testing"
+
+func TestSetCTCSS(t *testing.T) {
+	c, conn := connect(t)
+
+	params, err := conn.Expect("dspcontrol", testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tone, ok := params["ctcss_tone"]; ok {
+		t.Errorf("ctcss_tone %v sent without a tone set", tone)
+	}
+	// The handshake ends with the dspcontrol starting the demodulator.
+	if _, err := conn.Expect("dspcontrol", testTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tone := range []float64{88.5, 0} {
+		if err := c.SetCTCSS(tone); err != nil {
+			t.Fatal(err)
+		}
+		params, err := conn.Expect("dspcontrol", testTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := params["ctcss_tone"]; !ok || got != tone {
+			t.Errorf("after SetCTCSS(%g): ctcss_tone %v, want %g", tone, got, tone)
+		}
+	}
+}
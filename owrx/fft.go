@@ -0,0 +1,46 @@
+package owrx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// fftADPCMPadding is the number of samples preceding each compressed FFT
+// frame that let the decoder settle.
+const fftADPCMPadding = 10
+
+// DecodeFFT decodes the payload of a type 1 binary message into spectrum
+// magnitudes in dB across the receiver bandwidth, lowest frequency first.
+//
+// With fft_compression "none" the payload is a plain array of
+// little-endian float32 dB values, one per bin. With "adpcm" each frame is
+// an independent IMA ADPCM block of int16 values in 1/100 dB, preceded by
+// fftADPCMPadding samples.
+func DecodeFFT(data []byte, compression string) ([]float32, error) {
+	switch compression {
+	case "none":
+		if len(data)%4 != 0 {
+			return nil, fmt.Errorf("%w: payload of %d bytes is not a float32 array", ErrMalformedFrame, len(data))
+		}
+		bins := make([]float32, len(data)/4)
+		for i := range bins {
+			bins[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+		}
+		return bins, nil
+	case "adpcm":
+		var state ADPCMState
+		samples := decodeADPCMBlock(data, &state)
+		if len(samples) <= fftADPCMPadding {
+			return nil, fmt.Errorf("%w: compressed frame of %d bytes is too short", ErrMalformedFrame, len(data))
+		}
+		samples = samples[fftADPCMPadding:]
+		bins := make([]float32, len(samples))
+		for i, v := range samples {
+			bins[i] = float32(v) / 100
+		}
+		return bins, nil
+	default:
+		return nil, fmt.Errorf("unsupported fft_compression %q", compression)
+	}
+}
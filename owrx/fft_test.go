@@ -0,0 +1,47 @@
+package owrx
+
+import (
+	"reflect"
+	"testing"
+)
+
+// adpcmFFTFixture is a compressed FFT frame of 8 bins, encoded by an
+// independent IMA ADPCM encoder from 10 padding samples at -100 dB
+// followed by -100, -95, -90, -60, -60, -90, -98 and -100 dB.
+var adpcmFFTFixture = []byte{0xff, 0xff, 0xff, 0xff, 0x0d, 0x08, 0x30, 0xc0, 0x09}
+
+// adpcmFFTBins is what the fixture decodes to in 1/100 dB. The padding
+// decodes to -11, -41, -104, -240, -533, -1164, -2521, -5431, -10004 and
+// -9396 as the decoder settles, and must not show up.
+var adpcmFFTBins = []int16{-9949, -9446, -8989, -6080, -5702, -8794, -10040, -9662}
+
+func TestDecodeFFTADPCM(t *testing.T) {
+	bins, err := DecodeFFT(adpcmFFTFixture, "adpcm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]float32, len(adpcmFFTBins))
+	for i, v := range adpcmFFTBins {
+		want[i] = float32(v) / 100
+	}
+	if !reflect.DeepEqual(bins, want) {
+		t.Errorf("DecodeFFT = %v, want %v", bins, want)
+	}
+}
+
+func TestDecodeFFTADPCMIndependentFrames(t *testing.T) {
+	first, err := DecodeFFT(adpcmFFTFixture, "adpcm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every frame starts the decoder afresh, so decoding it again gives the
+	// same bins.
+	second, err := DecodeFFT(adpcmFFTFixture, "adpcm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("second decode = %v, want %v as the first", second, first)
+	}
+}
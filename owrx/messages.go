@@ -0,0 +1,381 @@
+package owrx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Message is a text message from the server. Its concrete type is the
+// pointer to one of the *Message structs below: HandshakeMessage for the
+// handshake line, the one chosen by the type field for JSON messages, or
+// UnknownMessage for types this package doesn't decode.
+type Message interface {
+	Type() string
+}
+
+// messageTypes creates the message decoded for each type.
+var messageTypes = map[string]func() Message{
+	"config":            func() Message { return &ConfigMessage{} },
+	"smeter":            func() Message { return &SmeterMessage{} },
+	"profiles":          func() Message { return &ProfilesMessage{} },
+	"bookmarks":         func() Message { return &BookmarksMessage{} },
+	"dial_frequencies":  func() Message { return &DialFrequenciesMessage{} },
+	"secondary_config":  func() Message { return &SecondaryConfigMessage{} },
+	"secondary_demod":   func() Message { return &SecondaryDemodMessage{} },
+	"receiver_details":  func() Message { return &ReceiverDetailsMessage{} },
+	"features":          func() Message { return &FeaturesMessage{} },
+	"modes":             func() Message { return &ModesMessage{} },
+	"backoff":           func() Message { return &BackoffMessage{} },
+	"sdr_error":         func() Message { return &SDRErrorMessage{} },
+	"demodulator_error": func() Message { return &DemodulatorErrorMessage{} },
+	"metadata":          func() Message { return &MetadataMessage{} },
+	"aprs_data":         func() Message { return &AprsDataMessage{} },
+	"wsjt_message":      func() Message { return &WsjtMessage{} },
+	"pocsag_data":       func() Message { return &PocsagMessage{} },
+}
+
+// DecodeMessage decodes a JSON text message by its type field.
+func DecodeMessage(data []byte) (Message, error) {
+	var unknown UnknownMessage
+	if err := json.Unmarshal(data, &unknown); err != nil {
+		return nil, err
+	}
+	newMessage, ok := messageTypes[unknown.MsgType]
+	if !ok {
+		return &unknown, nil
+	}
+
+	msg := newMessage()
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("decoding %s message: %v", unknown.MsgType, err)
+	}
+	return msg, nil
+}
+
+// UnknownMessage is a message of a type this package doesn't decode, such
+// as the output of the secondary decoders.
+type UnknownMessage struct {
+	MsgType string          `json:"type"`
+	Value   json.RawMessage `json:"value"`
+}
+
+func (m *UnknownMessage) Type() string { return m.MsgType }
+
+// ConfigMessage describes the active profile. The server sends it in full
+// on connecting and after a profile change, and with just what changed
+// otherwise, so every field is nil unless the message has it.
+type ConfigMessage struct {
+	Value Config `json:"value"`
+}
+
+// Config is the content of a config message.
+type Config struct {
+	ProfileID        *string          `json:"profile_id"`
+	SDRID            *string          `json:"sdr_id"`
+	CenterFreq       *int64           `json:"center_freq"`
+	SampleRate       *int64           `json:"samp_rate"`
+	AudioCompression *string          `json:"audio_compression"`
+	FFTCompression   *string          `json:"fft_compression"`
+	FFTSize          *int             `json:"fft_size"`
+	WaterfallLevels  *WaterfallLevels `json:"waterfall_levels"`
+}
+
+// WaterfallLevels is the dB range the operator set for the waterfall.
+type WaterfallLevels struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+func (m *ConfigMessage) Type() string { return "config" }
+
+// SmeterMessage is a signal strength reading, a linear power.
+type SmeterMessage struct {
+	Value float64 `json:"value"`
+}
+
+func (m *SmeterMessage) Type() string { return "smeter" }
+
+// ProfilesMessage lists the SDR profiles the server offers.
+type ProfilesMessage struct {
+	Value []Profile `json:"value"`
+}
+
+// Profile is an SDR profile, identified as "sdr|profile".
+type Profile struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (m *ProfilesMessage) Type() string { return "profiles" }
+
+// BookmarksMessage lists the bookmarks the operator set for the profile.
+type BookmarksMessage struct {
+	Value []Bookmark `json:"value"`
+}
+
+// Bookmark is a named frequency.
+type Bookmark struct {
+	Name       string `json:"name"`
+	Frequency  int64  `json:"frequency"`
+	Modulation string `json:"modulation"`
+}
+
+func (m *BookmarksMessage) Type() string { return "bookmarks" }
+
+// DialFrequenciesMessage lists where the digital modes are usually found
+// within the profile.
+type DialFrequenciesMessage struct {
+	Value []DialFrequency `json:"value"`
+}
+
+// DialFrequency is where a digital mode is usually found.
+type DialFrequency struct {
+	Mode      string `json:"mode"`
+	Frequency int64  `json:"frequency"`
+}
+
+func (m *DialFrequenciesMessage) Type() string { return "dial_frequencies" }
+
+// SecondaryConfigMessage describes the secondary demodulator once it runs.
+type SecondaryConfigMessage struct {
+	Value SecondaryConfig `json:"value"`
+}
+
+// SecondaryConfig is the content of a secondary_config message.
+type SecondaryConfig struct {
+	FFTSize      int     `json:"secondary_fft_size"`
+	IFSampleRate int     `json:"if_samp_rate"`
+	Bandwidth    float64 `json:"secondary_bw"`
+}
+
+func (m *SecondaryConfigMessage) Type() string { return "secondary_config" }
+
+// SecondaryDemodMessage is free text decoded by modes such as PSK31, RTTY
+// or CW.
+type SecondaryDemodMessage struct {
+	Value string `json:"value"`
+}
+
+func (m *SecondaryDemodMessage) Type() string { return "secondary_demod" }
+
+// ReceiverDetailsMessage is what the operator tells about the receiver.
+type ReceiverDetailsMessage struct {
+	Value ReceiverDetails `json:"value"`
+}
+
+// ReceiverDetails is the content of a receiver_details message.
+type ReceiverDetails struct {
+	Name       string  `json:"receiver_name"`
+	Location   string  `json:"receiver_location"`
+	Altitude   float64 `json:"receiver_asl"`
+	Admin      string  `json:"receiver_admin"`
+	GPS        *GPS    `json:"receiver_gps"`
+	PhotoTitle string  `json:"photo_title"`
+	PhotoDesc  string  `json:"photo_desc"`
+}
+
+// GPS is the position of the receiver in degrees.
+type GPS struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+func (m *ReceiverDetailsMessage) Type() string { return "receiver_details" }
+
+// FeaturesMessage tells which optional features, mostly decoders, the
+// server has.
+type FeaturesMessage struct {
+	Value map[string]bool `json:"value"`
+}
+
+func (m *FeaturesMessage) Type() string { return "features" }
+
+// ModesMessage lists the modes the server can demodulate.
+type ModesMessage struct {
+	Value []ServerMode `json:"value"`
+}
+
+// ServerMode is a mode the server offers.
+type ServerMode struct {
+	Modulation string `json:"modulation"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+}
+
+func (m *ModesMessage) Type() string { return "modes" }
+
+// BackoffMessage is sent right before the server closes the connection
+// because it is busy, e.g. has too many users. Delay, in seconds, is zero
+// unless the server suggests one.
+type BackoffMessage struct {
+	Reason string  `json:"reason"`
+	Delay  float64 `json:"delay"`
+}
+
+func (m *BackoffMessage) Type() string { return "backoff" }
+
+// SDRErrorMessage reports that the device behind the profile failed.
+type SDRErrorMessage struct {
+	Value string `json:"value"`
+}
+
+func (m *SDRErrorMessage) Type() string { return "sdr_error" }
+
+// DemodulatorErrorMessage reports that the demodulator couldn't start.
+type DemodulatorErrorMessage struct {
+	Value string `json:"value"`
+}
+
+func (m *DemodulatorErrorMessage) Type() string { return "demodulator_error" }
+
+// MetadataMessage is digital voice metadata, e.g. who is talking on DMR.
+type MetadataMessage struct {
+	Value Metadata `json:"value"`
+}
+
+// Metadata holds the fields of the DMR metadata; other protocols fill in
+// what applies to them.
+type Metadata struct {
+	Protocol    string              `json:"protocol"`
+	Slot        int                 `json:"slot"`
+	Sync        string              `json:"sync"`
+	CallType    string              `json:"type"`
+	Source      RadioID             `json:"source"`
+	Target      RadioID             `json:"target"`
+	ColorCode   *int                `json:"cc"`
+	TalkerAlias string              `json:"talkeralias"`
+	Additional  *MetadataAdditional `json:"additional"`
+}
+
+// MetadataAdditional is what the server looked up about the source.
+type MetadataAdditional struct {
+	Callsign  string `json:"callsign"`
+	FirstName string `json:"fname"`
+}
+
+func (m *MetadataMessage) Type() string { return "metadata" }
+
+// RadioID is a radio or talkgroup ID, which the server may send as a
+// number or a string.
+type RadioID string
+
+func (id *RadioID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = RadioID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("radio ID %s is neither a number nor a string", data)
+	}
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		*id = RadioID(strconv.FormatInt(i, 10))
+		return nil
+	}
+	*id = RadioID(n)
+	return nil
+}
+
+// AprsDataMessage is a packet frame decoded by the packet secondary
+// demodulator, parsed as APRS where possible.
+type AprsDataMessage struct {
+	Value AprsData `json:"value"`
+}
+
+// AprsData is the content of an aprs_data message. Lat and Lon are nil
+// unless the frame reports a position; Comment and Message hold the free
+// text of position and message frames.
+type AprsData struct {
+	Source      string   `json:"source"`
+	Destination string   `json:"destination"`
+	Path        []string `json:"path"`
+	Type        string   `json:"type"`
+	Lat         *float64 `json:"lat"`
+	Lon         *float64 `json:"lon"`
+	Comment     string   `json:"comment"`
+	Message     string   `json:"message"`
+	// OpenWebRX spells it addresse.
+	Addressee string `json:"addresse"`
+}
+
+func (m *AprsDataMessage) Type() string { return "aprs_data" }
+
+// WsjtMessage is a decode of one of the WSJT-X modes run by the secondary
+// demodulator, such as FT8 or WSPR.
+type WsjtMessage struct {
+	Value WsjtDecode `json:"value"`
+}
+
+// WsjtDecode is the content of a wsjt_message message. Timestamp is the
+// start of the decoded cycle in milliseconds since the epoch, Frequency the
+// absolute frequency in Hz, DB the SNR and DT the time offset in seconds.
+// Drift, in Hz, is only sent for WSPR. Callsign and Locator are filled in
+// when the server could make them out of Message.
+type WsjtDecode struct {
+	Mode      string  `json:"mode"`
+	Timestamp int64   `json:"timestamp"`
+	DB        float64 `json:"db"`
+	DT        float64 `json:"dt"`
+	Frequency int64   `json:"freq"`
+	Drift     int     `json:"drift"`
+	Message   string  `json:"msg"`
+	Callsign  string  `json:"callsign"`
+	Locator   string  `json:"locator"`
+}
+
+func (m *WsjtMessage) Type() string { return "wsjt_message" }
+
+// PocsagMessage is a pager message decoded by the POCSAG secondary
+// demodulator.
+type PocsagMessage struct {
+	Value PocsagData `json:"value"`
+}
+
+// PocsagData is the content of a pocsag_data message. Address is the
+// capcode and Function the two function bits, 0 to 3, when the server sends
+// them. Type is "numeric" or "alpha" if the server says which; otherwise it
+// can only be told from Message. A tone only page has an empty Message.
+type PocsagData struct {
+	Address  RadioID `json:"address"`
+	Function *int    `json:"function"`
+	Type     string  `json:"type"`
+	Message  string  `json:"message"`
+}
+
+func (m *PocsagMessage) Type() string { return "pocsag_data" }
+
+// HandshakeMessage is the server's handshake line, the one text message
+// that isn't JSON, e.g. "CLIENT DE SERVER server=openwebrx version=1.2.2".
+type HandshakeMessage struct {
+	Server  string
+	Version string
+}
+
+func (m *HandshakeMessage) Type() string { return "handshake" }
+
+const handshakePrefix = "CLIENT DE SERVER"
+
+// parseHandshake parses the key=value pairs of the handshake line.
+func parseHandshake(text string) (*HandshakeMessage, bool) {
+	if !strings.HasPrefix(text, handshakePrefix) {
+		return nil, false
+	}
+
+	m := &HandshakeMessage{}
+	for _, field := range strings.Fields(strings.TrimPrefix(text, handshakePrefix)) {
+		i := strings.Index(field, "=")
+		if i < 0 {
+			continue
+		}
+		switch field[:i] {
+		case "server":
+			m.Server = field[i+1:]
+		case "version":
+			m.Version = field[i+1:]
+		}
+	}
+	return m, true
+}
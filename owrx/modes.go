@@ -0,0 +1,59 @@
+package owrx
+
+// Mode is a demodulator OpenWebRX offers and the passband the client uses
+// for it unless told otherwise.
+type Mode struct {
+	Name    string
+	LowCut  int
+	HighCut int
+}
+
+// Modes lists the demodulators in the order the server's mode menu has
+// them, with the server's own passbands.
+var Modes = []Mode{
+	{"nfm", -4000, 4000},
+	{"wfm", -75000, 75000},
+	{"am", -4000, 4000},
+	{"sam", -4000, 4000},
+	{"lsb", -2700, -300},
+	{"usb", 300, 2700},
+	{"cw", 700, 900},
+	{"dmr", -6250, 6250},
+	{"dstar", -3250, 3250},
+	{"nxdn", -3250, 3250},
+	{"ysf", -6250, 6250},
+	{"m17", -6250, 6250},
+	{"freedv", 300, 3000},
+}
+
+// FindMode looks up a mode by name.
+func FindMode(name string) (Mode, bool) {
+	_, m, ok := findMode(name)
+	return m, ok
+}
+
+func findMode(name string) (int, Mode, bool) {
+	for i, m := range Modes {
+		if m.Name == name {
+			return i, m, true
+		}
+	}
+	return -1, Mode{}, false
+}
+
+// NextMode returns the mode dir places after name in Modes, wrapping
+// around at the ends.
+func NextMode(name string, dir int) Mode {
+	i, _, _ := findMode(name)
+	n := len(Modes)
+	return Modes[((i+dir)%n+n)%n]
+}
+
+// ModeNames returns the names of all modes.
+func ModeNames() []string {
+	names := make([]string, len(Modes))
+	for i, m := range Modes {
+		names[i] = m.Name
+	}
+	return names
+}
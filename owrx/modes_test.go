@@ -0,0 +1,31 @@
+package owrx
+
+import "testing"
+
+func TestModePassbands(t *testing.T) {
+	for name, want := range map[string][2]int{
+		"usb": {300, 2700},
+		"lsb": {-2700, -300},
+		"am":  {-4000, 4000},
+		"sam": {-4000, 4000},
+	} {
+		m, ok := FindMode(name)
+		if !ok {
+			t.Errorf("no mode %s", name)
+			continue
+		}
+		if m.LowCut != want[0] || m.HighCut != want[1] {
+			t.Errorf("%s passband %d..%d, want %d..%d", name, m.LowCut, m.HighCut, want[0], want[1])
+		}
+	}
+}
+
+func TestNextMode(t *testing.T) {
+	first, last := Modes[0].Name, Modes[len(Modes)-1].Name
+	if m := NextMode(last, 1); m.Name != first {
+		t.Errorf("NextMode(%s, 1) = %s, want %s", last, m.Name, first)
+	}
+	if m := NextMode(first, -1); m.Name != last {
+		t.Errorf("NextMode(%s, -1) = %s, want %s", first, m.Name, last)
+	}
+}
@@ -0,0 +1,198 @@
+package owrx
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Option configures a Client in NewClient.
+type Option func(c *Client)
+
+// WithTLS connects with TLS (wss://) using config, nil for the defaults.
+func WithTLS(config *tls.Config) Option {
+	return func(c *Client) {
+		c.secure = true
+		c.tlsConfig = config
+	}
+}
+
+// WithPath sets the WebSocket path, /ws/ by default. Servers behind a
+// reverse proxy may need another one, e.g. /sdr/ws/.
+func WithPath(path string) Option {
+	return func(c *Client) {
+		c.path = path
+	}
+}
+
+// WithHeader adds headers to the WebSocket handshake, e.g. for
+// authentication.
+func WithHeader(header http.Header) Option {
+	return func(c *Client) {
+		c.header = header
+	}
+}
+
+// WithConnectTimeout limits connecting and the WebSocket handshake, 10
+// seconds by default.
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.connectTimeout = timeout
+	}
+}
+
+// WithKeepalive pings the server every interval and drops the connection
+// when a pong doesn't come back within timeout. An interval of 0 disables
+// the pings.
+func WithKeepalive(interval, timeout time.Duration) Option {
+	return func(c *Client) {
+		c.pingInterval = interval
+		c.pingTimeout = timeout
+	}
+}
+
+// WithOutputRates sets the rates asked for the audio and the HD audio
+// streams, 11025 and 44100 Hz by default.
+func WithOutputRates(rate, hdRate int) Option {
+	return func(c *Client) {
+		c.outputRate = rate
+		c.hdOutputRate = hdRate
+	}
+}
+
+// WithReconnect makes Run connect again whenever a connection fails or
+// ends, waiting base at first and doubling the wait up to max while the
+// attempts keep failing.
+func WithReconnect(base, max time.Duration) Option {
+	return func(c *Client) {
+		c.reconnect = true
+		c.backoffBase = base
+		c.backoffMax = max
+	}
+}
+
+// WithReconnectLimit makes Run give up after n reconnects, counted over
+// its whole run rather than per outage. 0, the default, means no limit.
+func WithReconnectLimit(n int) Option {
+	return func(c *Client) {
+		c.maxReconnects = n
+	}
+}
+
+// WithDryRun connects and receives without changing anything on the
+// server: only the handshake and the connection properties, which the
+// server needs before it sends anything, are written. Every other message
+// is dropped, though the OnSend handlers still see it.
+func WithDryRun() Option {
+	return func(c *Client) {
+		c.dryRun = true
+	}
+}
+
+// WithProfile selects the server's SDR profile id, given as "sdr|profile".
+func WithProfile(id string) Option {
+	return func(c *Client) {
+		c.profile = id
+	}
+}
+
+// WithMode starts with the named demodulator and its default passband.
+func WithMode(name string) Option {
+	return func(c *Client) {
+		mode, ok := FindMode(name)
+		if !ok {
+			c.optionErr = fmt.Errorf("unknown mode %q", name)
+			return
+		}
+		c.dsp.Mod = mode.Name
+		c.dsp.LowCut = mode.LowCut
+		c.dsp.HighCut = mode.HighCut
+	}
+}
+
+// WithPassband sets the edges of the passband in Hz relative to the
+// offset, in place of the default of the mode, wherever WithMode comes.
+func WithPassband(low, high int) Option {
+	return func(c *Client) {
+		c.passband = &[2]int{low, high}
+	}
+}
+
+// WithOffset tunes to offset Hz from the profile's center frequency.
+func WithOffset(offset int) Option {
+	return func(c *Client) {
+		c.dsp.OffsetFreq = offset
+	}
+}
+
+// WithSquelch sets the squelch level in dB; -150, the default, keeps it
+// open.
+func WithSquelch(level int) Option {
+	return func(c *Client) {
+		c.dsp.SquelchLevel = level
+	}
+}
+
+// WithDMRFilter sets the DMR timeslot filter: DMRTimeslot1 or DMRTimeslot2
+// for one timeslot, DMRBothTimeslots, the default, for both. See
+// ParseDMRFilter for the preset names.
+func WithDMRFilter(filter int) Option {
+	return func(c *Client) {
+		c.dsp.DMRFilter = filter
+	}
+}
+
+// WithCTCSS makes the squelch open only on transmissions carrying tone,
+// one of CTCSSTones. The server needs a tone squelch for it to have any
+// effect.
+func WithCTCSS(tone float64) Option {
+	return func(c *Client) {
+		standard, ok := FindCTCSSTone(tone)
+		if !ok {
+			c.optionErr = fmt.Errorf("%g Hz is not a standard CTCSS tone", tone)
+			return
+		}
+		c.dsp.CTCSSTone = standard
+		c.dsp.ctcssUsed = true
+	}
+}
+
+// WithNoiseReduction turns noise reduction on or off and sets its threshold
+// in dB. Neither is sent until the caller sets DSP.NRAvailable.
+func WithNoiseReduction(enabled bool, threshold int) Option {
+	return func(c *Client) {
+		c.dsp.NoiseReduction = enabled
+		c.dsp.NRThreshold = threshold
+	}
+}
+
+// WithNotch sets the notch filter: auto has the server notch out carriers
+// it finds, and freqs are audio frequencies in Hz to notch out as well.
+func WithNotch(auto bool, freqs ...int) Option {
+	return func(c *Client) {
+		c.dsp.AutoNotch = auto
+		c.dsp.NotchFreqs = freqs
+	}
+}
+
+// WithAGC sets the AGC to one of AGCModes, with gain in dB applying when
+// it is off. Without it the server's AGC is left alone.
+func WithAGC(mode string, gain float64) Option {
+	return func(c *Client) {
+		if !ValidAGC(mode) {
+			c.optionErr = fmt.Errorf("unknown AGC mode %q", mode)
+			return
+		}
+		c.dsp.AGC = mode
+		c.dsp.Gain = gain
+	}
+}
+
+// WithSecondary runs the secondary demodulator for a digital mode such as
+// ft8 or packet.
+func WithSecondary(mode string) Option {
+	return func(c *Client) {
+		c.dsp.SecondaryMod = mode
+	}
+}
@@ -0,0 +1,20 @@
+package owrx
+
+import "testing"
+
+func TestWithPassbandOrder(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"mode first":     {WithMode("usb"), WithPassband(100, 2400)},
+		"passband first": {WithPassband(100, 2400), WithMode("usb")},
+	} {
+		d := NewClient("localhost:1", opts...).DSP()
+		if d.Mod != "usb" || d.LowCut != 100 || d.HighCut != 2400 {
+			t.Errorf("%s: %s %d..%d, want usb 100..2400", name, d.Mod, d.LowCut, d.HighCut)
+		}
+	}
+
+	usb, _ := FindMode("usb")
+	if d := NewClient("localhost:1", WithMode("usb")).DSP(); d.LowCut != usb.LowCut || d.HighCut != usb.HighCut {
+		t.Errorf("without WithPassband: %d..%d, want the usb default %d..%d", d.LowCut, d.HighCut, usb.LowCut, usb.HighCut)
+	}
+}
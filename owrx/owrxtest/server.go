@@ -0,0 +1,365 @@
+// Package owrxtest runs a stand-in for an OpenWebRX server, so code built on
+// the owrx package can be tested end to end without a receiver.
+//
+// A Server greets every connection like OpenWebRX does, answering the
+// client's handshake line with its own followed by the Greeting messages.
+// What happens next is up to the test, which gets hold of each connection
+// with Accept:
+//
+//	srv := owrxtest.NewServer()
+//	defer srv.Close()
+//
+//	c := owrx.NewClient(srv.Addr())
+//	c.OnSmeter(func(value float64) { ... })
+//	if err := c.Connect(ctx); err != nil { ... }
+//
+//	conn, err := srv.Accept(time.Second)
+//	if err != nil { ... }
+//	params, err := conn.Expect("dspcontrol", time.Second)
+//	conn.SendSmeter(0.5)
+package owrxtest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Banner is the handshake line the server answers the client's with.
+const Banner = "CLIENT DE SERVER server=openwebrx version=1.2.2"
+
+// handshakeTimeout is how long a new connection has to send the handshake
+// line.
+const handshakeTimeout = 5 * time.Second
+
+// ErrTimeout is returned when Accept or Expect give up waiting.
+var ErrTimeout = errors.New("timed out")
+
+// Server is an OpenWebRX stand-in listening on a local port.
+type Server struct {
+	// Greeting is sent, in order, to every new connection after the
+	// banner. It defaults to a config message with both streams
+	// uncompressed and a profiles message listing two profiles; change it
+	// before the client connects.
+	Greeting []interface{}
+
+	http     *httptest.Server
+	upgrader websocket.Upgrader
+	accepted chan *Conn
+	closed   chan struct{}
+
+	mu    sync.Mutex
+	conns []*Conn
+	count int
+}
+
+// NewServer starts a server serving the WebSocket on /ws/.
+func NewServer() *Server {
+	s := &Server{
+		Greeting: []interface{}{
+			map[string]interface{}{
+				"type": "config",
+				"value": map[string]interface{}{
+					"profile_id":        "2m",
+					"sdr_id":            "rtl",
+					"center_freq":       145000000,
+					"samp_rate":         2400000,
+					"start_mod":         "nfm",
+					"start_offset_freq": 0,
+					"audio_compression": "none",
+					"fft_compression":   "none",
+				},
+			},
+			map[string]interface{}{
+				"type": "profiles",
+				"value": []interface{}{
+					map[string]interface{}{"id": "rtl|2m", "name": "RTL 2m"},
+					map[string]interface{}{"id": "rtl|70cm", "name": "RTL 70cm"},
+				},
+			},
+		},
+		accepted: make(chan *Conn, 16),
+		closed:   make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws/", s.serve)
+	s.http = httptest.NewServer(mux)
+	return s
+}
+
+// Addr returns the host and port to hand to owrx.NewClient.
+func (s *Server) Addr() string {
+	return strings.TrimPrefix(s.http.URL, "http://")
+}
+
+// Connections returns how many connections the server has accepted.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.count
+}
+
+// Accept waits for the next connection the server has greeted.
+func (s *Server) Accept(timeout time.Duration) (*Conn, error) {
+	select {
+	case conn := <-s.accepted:
+		return conn, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("waiting for a connection: %w", ErrTimeout)
+	}
+}
+
+// Close drops every connection and stops the server.
+func (s *Server) Close() {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = nil
+	s.mu.Unlock()
+
+	close(s.closed)
+	for _, conn := range conns {
+		conn.ws.Close()
+	}
+	s.http.Close()
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	conn := &Conn{ws: ws, arrived: make(chan struct{}, 1), done: make(chan struct{})}
+	s.mu.Lock()
+	s.conns = append(s.conns, conn)
+	s.count++
+	greeting := s.Greeting
+	s.mu.Unlock()
+
+	go conn.read()
+
+	if text, err := conn.Next(handshakeTimeout); err != nil || !strings.HasPrefix(text, "SERVER DE CLIENT") {
+		ws.Close()
+		return
+	}
+	if err := conn.SendText(Banner); err != nil {
+		ws.Close()
+		return
+	}
+	for _, msg := range greeting {
+		if err := conn.Send(msg); err != nil {
+			ws.Close()
+			return
+		}
+	}
+	select {
+	case s.accepted <- conn:
+	case <-s.closed:
+	}
+}
+
+// Conn is a client connection to the server.
+type Conn struct {
+	ws *websocket.Conn
+
+	// writeMu serializes writes, which the websocket package requires.
+	writeMu sync.Mutex
+
+	// The client's text messages queue up until Next takes them, so an
+	// unread message never holds up the connection.
+	mu       sync.Mutex
+	received [][]byte
+	arrived  chan struct{}
+
+	done chan struct{}
+	err  error
+}
+
+func (c *Conn) read() {
+	defer close(c.done)
+
+	for {
+		messageType, data, err := c.ws.ReadMessage()
+		if err != nil {
+			c.err = err
+			return
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+
+		c.mu.Lock()
+		c.received = append(c.received, data)
+		c.mu.Unlock()
+		select {
+		case c.arrived <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Done returns a channel closed when the connection ends.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns what ended the connection, once Done is closed. Closing it
+// from the client shows up as a *websocket.CloseError.
+func (c *Conn) Err() error {
+	<-c.done
+	return c.err
+}
+
+// Next waits for the next text message from the client.
+func (c *Conn) Next(timeout time.Duration) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		c.mu.Lock()
+		if len(c.received) > 0 {
+			data := c.received[0]
+			c.received = c.received[1:]
+			c.mu.Unlock()
+			return string(data), nil
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-c.arrived:
+		case <-c.done:
+			c.mu.Lock()
+			pending := len(c.received)
+			c.mu.Unlock()
+			if pending == 0 {
+				return "", fmt.Errorf("connection closed: %v", c.err)
+			}
+		case <-timer.C:
+			return "", fmt.Errorf("waiting for a message: %w", ErrTimeout)
+		}
+	}
+}
+
+// Expect skips the client's messages until one of msgType comes and returns
+// its params.
+func (c *Conn) Expect(msgType string, timeout time.Duration) (map[string]interface{}, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		text, err := c.Next(time.Until(deadline))
+		if err != nil {
+			return nil, fmt.Errorf("expecting %s: %w", msgType, err)
+		}
+		var msg struct {
+			Type   string                 `json:"type"`
+			Params map[string]interface{} `json:"params"`
+		}
+		if err := json.Unmarshal([]byte(text), &msg); err != nil {
+			return nil, fmt.Errorf("client sent %q: %v", text, err)
+		}
+		if msg.Type == msgType {
+			return msg.Params, nil
+		}
+	}
+}
+
+// Send sends a JSON text message, e.g. a map with type and value keys.
+func (c *Conn) Send(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.write(websocket.TextMessage, data)
+}
+
+// SendText sends a text message as is.
+func (c *Conn) SendText(text string) error {
+	return c.write(websocket.TextMessage, []byte(text))
+}
+
+// SendValue sends a message of msgType with value, the form of most
+// OpenWebRX messages.
+func (c *Conn) SendValue(msgType string, value interface{}) error {
+	return c.Send(map[string]interface{}{"type": msgType, "value": value})
+}
+
+// SendSmeter sends a smeter reading, a linear power.
+func (c *Conn) SendSmeter(value float64) error {
+	return c.SendValue("smeter", value)
+}
+
+// SendBinary sends a binary message of kind, e.g. 1 for FFT or 2 for
+// audio, with an already encoded payload.
+func (c *Conn) SendBinary(kind byte, payload []byte) error {
+	return c.write(websocket.BinaryMessage, append([]byte{kind}, payload...))
+}
+
+// SendAudio sends uncompressed audio, matching the default Greeting. With
+// hd it goes to the HD stream.
+func (c *Conn) SendAudio(samples []int16, hd bool) error {
+	payload := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(payload[2*i:], uint16(s))
+	}
+	kind := byte(2)
+	if hd {
+		kind = 4
+	}
+	return c.SendBinary(kind, payload)
+}
+
+// SendFFT sends an uncompressed FFT line in dB, matching the default
+// Greeting.
+func (c *Conn) SendFFT(bins []float32) error {
+	payload := make([]byte, 4*len(bins))
+	for i, v := range bins {
+		binary.LittleEndian.PutUint32(payload[4*i:], math.Float32bits(v))
+	}
+	return c.SendBinary(1, payload)
+}
+
+// Backoff tells the client the server is busy, like OpenWebRX does when
+// it has too many users, and drops the connection.
+func (c *Conn) Backoff(reason string) error {
+	if err := c.Send(map[string]interface{}{"type": "backoff", "reason": reason}); err != nil {
+		return err
+	}
+	return c.ws.Close()
+}
+
+// Close sends a close frame with code and text, e.g.
+// websocket.CloseServiceRestart, and waits for the client to answer it.
+func (c *Conn) Close(code int, text string) error {
+	err := c.write(websocket.CloseMessage, websocket.FormatCloseMessage(code, text))
+	if err == nil {
+		select {
+		case <-c.done:
+		case <-time.After(2 * time.Second):
+		}
+	}
+	c.ws.Close()
+	return err
+}
+
+// Drop closes the connection without a close frame, like a network
+// failure.
+func (c *Conn) Drop() error {
+	return c.ws.Close()
+}
+
+func (c *Conn) write(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.ws.WriteMessage(messageType, data)
+}
@@ -0,0 +1,183 @@
+package owrx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// State is a step in the life of a connection run by Run.
+type State int
+
+const (
+	// StateConnecting is reported before every connection attempt.
+	StateConnecting State = iota
+	// StateConnected is reported once the handshake has been sent.
+	StateConnected
+	// StateConnectFailed is reported when an attempt fails, with the
+	// error.
+	StateConnectFailed
+	// StateDisconnected is reported when a connection ends, with the
+	// error that ended it.
+	StateDisconnected
+	// StateWaiting is reported before waiting to reconnect, with the
+	// attempt about to be made and the delay.
+	StateWaiting
+	// StateClosing is reported when Run closes the connection because its
+	// context was cancelled.
+	StateClosing
+	// StateAudioStarted is reported when the first audio of a connection
+	// reaches the audio handlers, with how many frames were held because
+	// they arrived before the first handler was registered.
+	StateAudioStarted
+)
+
+// Status describes a change of State.
+type Status struct {
+	State   State
+	Err     error
+	Attempt int
+	Delay   time.Duration
+	Held    int
+}
+
+// OnStatus registers a handler following the connections made by Run and
+// the start of their audio.
+func (c *Client) OnStatus(handler func(status Status)) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.statusHandlers = append(c.statusHandlers, handler)
+}
+
+func (c *Client) notify(status Status) {
+	c.handlersMu.Lock()
+	handlers := c.statusHandlers
+	c.handlersMu.Unlock()
+	for _, handler := range handlers {
+		handler(status)
+	}
+}
+
+// Run connects and serves the connection until ctx is cancelled, when it
+// closes the connection and returns nil. With WithReconnect it connects
+// again whenever an attempt fails or a connection ends, unless the way the
+// server closed it means retrying won't help, which is returned as an
+// error. Without it Run returns once the connection ends, or with the
+// error if connecting fails. With WithReconnectLimit it returns an error
+// wrapping ErrReconnectLimit once the reconnects are used up.
+func (c *Client) Run(ctx context.Context) error {
+	reconnects := 0
+	for attempt := 1; ; attempt++ {
+		c.notify(Status{State: StateConnecting})
+		err := c.Connect(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			c.notify(Status{State: StateConnectFailed, Err: err})
+			if !c.reconnect {
+				return err
+			}
+		default:
+			attempt = 1
+			c.notify(Status{State: StateConnected})
+
+			select {
+			case <-c.Done():
+				err = c.Err()
+				c.notify(Status{State: StateDisconnected, Err: err})
+			case <-ctx.Done():
+				c.notify(Status{State: StateClosing})
+				return c.Close()
+			}
+			if !c.reconnect {
+				return nil
+			}
+		}
+
+		if c.maxReconnects > 0 && reconnects >= c.maxReconnects {
+			if err == nil {
+				return fmt.Errorf("%w after %d attempts", ErrReconnectLimit, reconnects)
+			}
+			return fmt.Errorf("%w after %d attempts, last error: %v", ErrReconnectLimit, reconnects, err)
+		}
+		reconnects++
+
+		delay, err := c.retryDelay(attempt)
+		if err != nil {
+			return err
+		}
+		c.notify(Status{State: StateWaiting, Attempt: attempt, Delay: delay})
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// backoffDelay is the exponential backoff before the given attempt,
+// doubling from the base delay up to the maximum.
+func (c *Client) backoffDelay(attempt int) time.Duration {
+	delay := c.backoffBase
+	for i := 1; i < attempt && delay < c.backoffMax; i++ {
+		delay *= 2
+	}
+	if delay > c.backoffMax {
+		delay = c.backoffMax
+	}
+	return delay
+}
+
+// retryDelay picks the delay before reconnecting based on how the server
+// closed the last connection, or asked to back off before that. Either
+// only counts for the first retry after a disconnect; failed attempts after
+// it back off exponentially. It returns an error when the close code means
+// reconnecting won't help.
+func (c *Client) retryDelay(attempt int) (time.Duration, error) {
+	c.mu.Lock()
+	backoff, err := c.backoff, c.closeErr
+	c.backoff, c.closeErr = 0, nil
+	c.mu.Unlock()
+
+	if backoff > 0 {
+		return backoff, nil
+	}
+
+	// 1006 is synthesized locally when the connection drops without a
+	// close frame, so it says nothing about the server.
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code == websocket.CloseAbnormalClosure {
+		return c.backoffDelay(attempt), nil
+	}
+
+	switch closeErr.Code {
+	case websocket.ClosePolicyViolation, websocket.CloseProtocolError, websocket.CloseUnsupportedData:
+		return 0, fmt.Errorf("not reconnecting after close code %d", closeErr.Code)
+	case websocket.CloseServiceRestart, websocket.CloseGoingAway:
+		// The server is coming back, retry without escalating.
+		return c.backoffBase, nil
+	case websocket.CloseTryAgainLater:
+		return c.backoffMax, nil
+	}
+	return c.backoffDelay(attempt), nil
+}
+
+// handleBackoff records a backoff message. OpenWebRX gives a reason but no
+// delay, so the maximum backoff is used unless the message has one.
+func (c *Client) handleBackoff(msg *BackoffMessage) {
+	delay := c.backoffMax
+	if msg.Delay > 0 {
+		delay = time.Duration(msg.Delay * float64(time.Second))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.backoff = delay
+}
@@ -0,0 +1,30 @@
+package owrx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// supportedMajorVersion is the OpenWebRX major version whose protocol this
+// package speaks. OpenWebRX+ numbers its releases the same way.
+const supportedMajorVersion = 1
+
+// CheckServerVersion returns an error if version, as given in the
+// handshake, isn't one this package understands. Servers before 1.0 spoke
+// a different protocol, and a later major version is likely to change it
+// again.
+func CheckServerVersion(version string) error {
+	if version == "" {
+		return fmt.Errorf("the server didn't give its version, as OpenWebRX before 1.0 didn't")
+	}
+
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	if err != nil {
+		return fmt.Errorf("can't make out server version %q", version)
+	}
+	if major != supportedMajorVersion {
+		return fmt.Errorf("server version %s isn't supported, only %d.x is", version, supportedMajorVersion)
+	}
+	return nil
+}
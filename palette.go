@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// palette maps a position from 0 (weakest) to 1 (strongest) to a color
+// for the waterfalls. A smooth one blends between its stops; classic steps
+// from one to the next like the 256-color ramp it comes from.
+type palette struct {
+	stops  []color.RGBA
+	smooth bool
+}
+
+func hexPalette(colors ...string) palette {
+	p := palette{smooth: true}
+	for _, c := range colors {
+		v, _ := strconv.ParseUint(c, 16, 32)
+		p.stops = append(p.stops, color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255})
+	}
+	return p
+}
+
+func classicPalette() palette {
+	var p palette
+	for _, i := range waterfallColors {
+		p.stops = append(p.stops, xtermColor(i))
+	}
+	return p
+}
+
+var palettes = map[string]palette{
+	"classic":   classicPalette(),
+	"viridis":   hexPalette("440154", "482878", "3e4989", "31688e", "26828e", "1f9e89", "35b779", "6ece58", "b5de2b", "fde725"),
+	"turbo":     hexPalette("30123b", "4145ab", "4675ed", "39a2fc", "1bcfd4", "24eca6", "61fc6c", "a4fc3b", "d1e834", "f3c63a", "fe9b2d", "f36315", "d93806", "b11901", "7a0403"),
+	"grayscale": hexPalette("000000", "ffffff"),
+}
+
+// waterfallPalette is the -palette in use.
+var waterfallPalette = palettes["classic"]
+
+func paletteNames() []string {
+	names := make([]string, 0, len(palettes))
+	for name := range palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// color returns the color of v on a scale from low to high dB.
+func (p palette) color(v, low, high float32) color.RGBA {
+	pos := float32(0)
+	if high > low {
+		pos = (v - low) / (high - low)
+	}
+	pos = float32(math.Max(0, math.Min(1, float64(pos))))
+
+	last := len(p.stops) - 1
+	if !p.smooth {
+		return p.stops[clamp(int(pos*float32(last)), 0, last)]
+	}
+	x := pos * float32(last)
+	i := clamp(int(x), 0, last-1)
+	a, b, t := p.stops[i], p.stops[i+1], x-float32(i)
+	mix := func(a, b uint8) uint8 {
+		return uint8(float32(a) + (float32(b)-float32(a))*t + 0.5)
+	}
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
+
+// ansi returns the 256-color index closest to the color of v.
+func (p palette) ansi(v, low, high float32) int {
+	return xtermIndex(p.color(v, low, high))
+}
+
+// xtermIndex is the nearest color of the 256-color palette's 6x6x6 cube or
+// its gray ramp, the inverse of xtermColor.
+func xtermIndex(c color.RGBA) int {
+	levels := [6]int{0, 95, 135, 175, 215, 255}
+	nearest := func(v uint8) int {
+		best := 0
+		for i, l := range levels {
+			if abs(int(v)-l) < abs(int(v)-levels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	r, g, b := nearest(c.R), nearest(c.G), nearest(c.B)
+	cube := 16 + 36*r + 6*g + b
+
+	avg := (int(c.R) + int(c.G) + int(c.B)) / 3
+	grayIndex := 232 + clamp((avg-8+5)/10, 0, 23)
+	if colorDistance(c, xtermColor(grayIndex)) < colorDistance(c, xtermColor(cube)) {
+		return grayIndex
+	}
+	return cube
+}
+
+func colorDistance(a, b color.RGBA) int {
+	dr, dg, db := int(a.R)-int(b.R), int(a.G)-int(b.G), int(a.B)-int(b.B)
+	return dr*dr + dg*dg + db*db
+}
+
+// waterfallScaleMode is how the waterfalls pick their dB range, set with
+// -waterfall-range.
+type waterfallScaleMode int
+
+const (
+	// scaleAuto follows the noise floor and the strongest signals.
+	scaleAuto waterfallScaleMode = iota
+	// scaleServer uses the range the operator configured.
+	scaleServer
+	// scaleFixed uses the range given on the command line.
+	scaleFixed
+)
+
+const (
+	// The automatic range starts this many dB below the noise floor and
+	// ends as far above the peaks, spanning at least autoRangeMinSpan.
+	autoRangeMargin  = 5
+	autoRangeMinSpan = 30
+
+	// The noise floor follows each frame's median smoothly. The peak level
+	// jumps up to a stronger signal at once and falls back slowly, so the
+	// colors don't flicker between transmissions.
+	autoRangeFloorSmoothing = 0.1
+	autoRangePeakDecay      = 0.02
+)
+
+var (
+	waterfallScaling   = scaleAuto
+	waterfallFixedLow  float32
+	waterfallFixedHigh float32
+)
+
+// waterfallScale follows the levels in the FFT to pick the range the
+// palette spans.
+type waterfallScale struct {
+	floor  float32
+	peak   float32
+	primed bool
+}
+
+func (s *waterfallScale) update(bins []float32) {
+	if len(bins) == 0 {
+		return
+	}
+	floor, peak := median(bins), maxBin(bins)
+	if !s.primed {
+		s.floor, s.peak, s.primed = floor, peak, true
+		return
+	}
+	s.floor += (floor - s.floor) * autoRangeFloorSmoothing
+	if peak > s.peak {
+		s.peak = peak
+	} else {
+		s.peak += (peak - s.peak) * autoRangePeakDecay
+	}
+}
+
+// bounds returns the dB range to color, per -waterfall-range.
+func (s *waterfallScale) bounds(r receiverState) (low, high float32) {
+	switch {
+	case waterfallScaling == scaleFixed:
+		return waterfallFixedLow, waterfallFixedHigh
+	case waterfallScaling == scaleServer || !s.primed:
+		return r.waterfallRange()
+	}
+	low, high = s.floor-autoRangeMargin, s.peak+autoRangeMargin
+	if high-low < autoRangeMinSpan {
+		high = low + autoRangeMinSpan
+	}
+	return low, high
+}
+
+// scaleOf is the automatic range of a whole image: the median noise floor
+// of the rows and a high percentile of their peaks, so a single burst
+// doesn't wash out the rest.
+func scaleOf(rows [][]float32) waterfallScale {
+	if len(rows) == 0 {
+		return waterfallScale{}
+	}
+	floors := make([]float32, len(rows))
+	peaks := make([]float32, len(rows))
+	for i, row := range rows {
+		floors[i], peaks[i] = median(row), maxBin(row)
+	}
+	sort.Slice(peaks, func(i, j int) bool { return peaks[i] < peaks[j] })
+	return waterfallScale{
+		floor:  median(floors),
+		peak:   peaks[(len(peaks)-1)*99/100],
+		primed: true,
+	}
+}
+
+func maxBin(bins []float32) float32 {
+	peak := float32(math.Inf(-1))
+	for _, v := range bins {
+		if v > peak {
+			peak = v
+		}
+	}
+	return peak
+}
+
+// validateWaterfall checks -palette and -waterfall-range.
+func validateWaterfall() {
+	p, ok := palettes[*paletteName]
+	if !ok {
+		fatalf("Unknown -palette %q, use %s", *paletteName, strings.Join(paletteNames(), ", "))
+	}
+	waterfallPalette = p
+
+	switch *waterfallDB {
+	case "auto":
+		waterfallScaling = scaleAuto
+	case "server":
+		waterfallScaling = scaleServer
+	default:
+		low, high, err := parseDBRange(*waterfallDB)
+		if err != nil {
+			fatalf("Invalid -waterfall-range %q: %v, use auto, server or min:max in dB, e.g. -120:-20", *waterfallDB, err)
+		}
+		waterfallScaling = scaleFixed
+		waterfallFixedLow, waterfallFixedHigh = low, high
+	}
+}
+
+func parseDBRange(value string) (low, high float32, err error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("not min:max")
+	}
+	l, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%q isn't a number", parts[0])
+	}
+	h, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%q isn't a number", parts[1])
+	}
+	if h <= l {
+		return 0, 0, fmt.Errorf("max must be above min")
+	}
+	return float32(l), float32(h), nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// pcmWriter streams headerless little-endian 16-bit PCM, for piping into
+// tools such as aplay or sox.
+type pcmWriter struct {
+	buf *bufio.Writer
+	rateLock
+}
+
+func newPCMWriter(w io.Writer) *pcmWriter {
+	return &pcmWriter{buf: bufio.NewWriter(w)}
+}
+
+func (w *pcmWriter) WriteAudio(frame owrx.AudioFrame) error {
+	if !w.accept(frame) {
+		return nil
+	}
+
+	if err := binary.Write(w.buf, binary.LittleEndian, frame.Samples); err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
+
+func (w *pcmWriter) Close() error {
+	return w.buf.Flush()
+}
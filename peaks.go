@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// noiseFloorSmoothing is the weight of the newest frame in the noise floor
+// estimate.
+const noiseFloorSmoothing = 0.1
+
+// Peak is a bin standing out from the noise floor, as given in a peak
+// event of the -json dump.
+type Peak struct {
+	Time       time.Time `json:"time"`
+	OffsetHz   int64     `json:"offset_hz"`
+	FreqHz     int64     `json:"abs_freq_hz"`
+	Magnitude  float32   `json:"magnitude_db"`
+	NoiseFloor float32   `json:"noise_floor_db"`
+}
+
+// peakDetector finds the bins in each FFT frame that exceed an adaptive
+// noise floor, the per-frame median smoothed over time, by threshold dB.
+type peakDetector struct {
+	threshold  float32
+	separation int64
+	floor      float32
+	primed     bool
+	last       string
+	handlers   []func(peaks []Peak)
+}
+
+func newPeakDetector(threshold float64, separation int) *peakDetector {
+	return &peakDetector{
+		threshold:  float32(threshold),
+		separation: int64(separation),
+	}
+}
+
+func median(bins []float32) float32 {
+	sorted := make([]float32, len(bins))
+	copy(sorted, bins)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+func (d *peakDetector) detect(frame FFTFrame) []Peak {
+	if len(frame.Bins) < 3 {
+		return nil
+	}
+
+	m := median(frame.Bins)
+	if !d.primed {
+		d.floor = m
+		d.primed = true
+	} else {
+		d.floor += (m - d.floor) * noiseFloorSmoothing
+	}
+
+	r := currentReceiver()
+	n := len(frame.Bins)
+	limit := d.floor + d.threshold
+
+	var candidates []Peak
+	for i := 1; i < n-1; i++ {
+		v := frame.Bins[i]
+		if v <= limit || v < frame.Bins[i-1] || v < frame.Bins[i+1] {
+			continue
+		}
+		freq := r.binFrequency(i, n)
+		candidates = append(candidates, Peak{
+			Time:       frame.Time,
+			OffsetHz:   freq - r.CenterFreq,
+			FreqHz:     freq,
+			Magnitude:  v,
+			NoiseFloor: d.floor,
+		})
+	}
+
+	// Strongest first, dropping anything closer than the separation to a
+	// peak already taken.
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Magnitude > candidates[j].Magnitude })
+	var peaks []Peak
+	for _, c := range candidates {
+		if d.tooClose(c, peaks) {
+			continue
+		}
+		peaks = append(peaks, c)
+	}
+	sort.Slice(peaks, func(i, j int) bool { return peaks[i].OffsetHz < peaks[j].OffsetHz })
+
+	return peaks
+}
+
+func (d *peakDetector) tooClose(p Peak, peaks []Peak) bool {
+	for _, q := range peaks {
+		if abs64(p.OffsetHz-q.OffsetHz) < d.separation {
+			return true
+		}
+	}
+	return false
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func (d *peakDetector) handleFFT(frame FFTFrame) {
+	peaks := d.detect(frame)
+	for _, handler := range d.handlers {
+		handler(peaks)
+	}
+}
+
+// logPeaks logs the detected peaks whenever the set of active signals
+// changes.
+func (d *peakDetector) logPeaks(peaks []Peak) {
+	offsets := make([]string, len(peaks))
+	for i, p := range peaks {
+		offsets[i] = fmt.Sprint(p.OffsetHz)
+	}
+	key := strings.Join(offsets, ",")
+	if key == d.last {
+		return
+	}
+	d.last = key
+
+	parts := make([]string, len(peaks))
+	for i, p := range peaks {
+		parts[i] = fmt.Sprintf("%+d Hz (%.1f dB)", p.OffsetHz, p.Magnitude)
+	}
+
+	if len(peaks) == 0 {
+		infof("Peaks: none above %.1f dB (noise floor %.1f dB)", d.floor+d.threshold, d.floor)
+		return
+	}
+	infof("Peaks: %s (noise floor %.1f dB)", strings.Join(parts, ", "), d.floor)
+}
+
+// dumpPeaks adds every peak of a frame to the -json dump as an event of its
+// own, for tools that log signals or start recordings on them.
+func dumpPeaks(peaks []Peak) {
+	for _, p := range peaks {
+		dumpEvent("peak", p)
+	}
+}
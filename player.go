@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+const (
+	defaultPlayCommand = "aplay -q -t raw -f S16_LE -c 1 -r {rate} --buffer-time=50000"
+	playChunk          = 20 * time.Millisecond
+	playMaxBuffered    = 4
+)
+
+// player feeds decoded audio to an external playback command through a
+// jitter buffer. The command is started on the first frame and gets its
+// sample rate via the {rate} placeholder, so conversion to the device rate is
+// left to the sound system.
+type player struct {
+	command string
+	delay   time.Duration
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	rateLock
+
+	chunk int
+
+	mu        sync.Mutex
+	buffer    *AudioBuffer
+	buffering bool
+	draining  bool
+	closed    bool
+	// kill is set once drain has given up on the command.
+	kill      bool
+	underruns int
+	done      chan struct{}
+}
+
+func newPlayer(command string, latency time.Duration) (*player, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("empty playback command")
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, err
+	}
+
+	return &player{
+		command:   command,
+		delay:     latency,
+		buffer:    NewAudioBuffer(latency * playMaxBuffered),
+		buffering: true,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+func (p *player) start(rate int) error {
+	args := strings.Fields(strings.ReplaceAll(p.command, "{rate}", strconv.Itoa(rate)))
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	// Playback is drained on exit; Ctrl-C reaching the command would cut it.
+	detachSignals(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	p.cmd = cmd
+	p.stdin = stdin
+	p.chunk = samplesFor(playChunk, rate)
+	go p.run()
+
+	return nil
+}
+
+func samplesFor(d time.Duration, rate int) int {
+	return int(d * time.Duration(rate) / time.Second)
+}
+
+func (p *player) WriteAudio(frame owrx.AudioFrame) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || !p.accept(frame) {
+		return nil
+	}
+	if p.cmd == nil {
+		if err := p.start(frame.Rate); err != nil {
+			p.closed = true
+			return err
+		}
+	}
+
+	if dropped := p.buffer.Write(frame); dropped > 0 {
+		warnf("playback overrun, dropped %d samples", dropped)
+	}
+	return nil
+}
+
+func (p *player) next() ([]int16, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, false
+	}
+
+	if p.buffering && !p.draining && p.buffer.Buffered() < p.delay {
+		return make([]int16, p.chunk), true
+	}
+	p.buffering = false
+
+	frame, ok := p.buffer.TryRead(p.chunk)
+	if !ok && p.draining {
+		return nil, false
+	}
+	if !ok {
+		p.underruns++
+		p.buffering = true
+		warnf("playback underrun (%d total)", p.underruns)
+		return make([]int16, p.chunk), true
+	}
+
+	return frame.Samples, true
+}
+
+// stats returns the state of the jitter buffer and how often it ran dry.
+func (p *player) stats() (AudioBufferStats, int) {
+	p.mu.Lock()
+	underruns := p.underruns
+	p.mu.Unlock()
+
+	return p.buffer.Stats(), underruns
+}
+
+func (p *player) run() {
+	defer close(p.done)
+
+	for {
+		samples, ok := p.next()
+		if !ok {
+			return
+		}
+		if err := binary.Write(p.stdin, binary.LittleEndian, samples); err != nil {
+			if !p.killed() {
+				warnf("playback stopped: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// drain plays what is left in the jitter buffer, for no longer than until
+// deadline, and stops playback.
+func (p *player) drain(deadline time.Time) {
+	p.mu.Lock()
+	started := p.cmd != nil && !p.closed
+	p.draining = true
+	p.mu.Unlock()
+
+	if !started {
+		return
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-p.done:
+	case <-timer.C:
+		warnf("playback didn't finish in time, dropping %v of audio", p.buffer.Buffered().Round(time.Millisecond))
+		p.mu.Lock()
+		p.closed, p.kill = true, true
+		p.mu.Unlock()
+		// The command may not be reading, which would block run for good.
+		p.cmd.Process.Kill()
+	}
+}
+
+func (p *player) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	started := p.cmd != nil
+	p.mu.Unlock()
+
+	if !started {
+		return nil
+	}
+
+	p.buffer.Close()
+	<-p.done
+	p.stdin.Close()
+	if err := p.cmd.Wait(); err != nil && !p.killed() {
+		return err
+	}
+	return nil
+}
+
+func (p *player) killed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.kill
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// maxCapcode is the largest POCSAG address, 21 bits.
+const maxCapcode = 1<<21 - 1
+
+// pocsagNumericChars are the characters of the numeric format, which packs
+// them four bits each.
+const pocsagNumericChars = "0123456789*U -)("
+
+// capcodeFilter holds the -capcode list; an empty one lets every page
+// through.
+var capcodeFilter = map[int]bool{}
+
+// pocsagPage is a received pager message.
+type pocsagPage struct {
+	Capcode  int    `json:"capcode"`
+	Function *int   `json:"function,omitempty"`
+	Format   string `json:"format"`
+	Message  string `json:"message,omitempty"`
+}
+
+func validateCapcodes() {
+	if *capcodes == "" {
+		return
+	}
+	for _, field := range strings.Split(*capcodes, ",") {
+		capcode, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || capcode < 0 || capcode > maxCapcode {
+			fatalf("-capcode takes capcodes from 0 to %d separated by commas, got %q", maxCapcode, field)
+		}
+		capcodeFilter[capcode] = true
+	}
+}
+
+// handlePocsag logs a page to one of the -capcode addresses, or any page
+// without it, and adds it to the -json dump.
+func handlePocsag(data owrx.PocsagData) {
+	capcode, err := strconv.Atoi(string(data.Address))
+	if err != nil {
+		debugf("ignoring POCSAG message with address %q", data.Address)
+		return
+	}
+	if len(capcodeFilter) > 0 && !capcodeFilter[capcode] {
+		return
+	}
+
+	p := pocsagPage{
+		Capcode:  capcode,
+		Function: data.Function,
+		Format:   pocsagFormat(data),
+		Message:  strings.TrimRight(data.Message, "\x00\r\n"),
+	}
+	if p.Format == "numeric" {
+		p.Message = strings.TrimSpace(p.Message)
+	}
+
+	infof("POCSAG %s", p)
+	dumpEvent("pocsag", p)
+	recordDecoded("pocsag", p)
+}
+
+// pocsagFormat tells a numeric page from an alphanumeric one. The server
+// says which in newer versions; older ones only send the text, in which
+// case a message made of numeric characters alone is taken as numeric.
+func pocsagFormat(data owrx.PocsagData) string {
+	switch strings.ToLower(data.Type) {
+	case "numeric":
+		return "numeric"
+	case "alpha", "alphanumeric":
+		return "alpha"
+	}
+	if data.Message == "" {
+		return "tone"
+	}
+	for _, r := range data.Message {
+		if !strings.ContainsRune(pocsagNumericChars, r) {
+			return "alpha"
+		}
+	}
+	return "numeric"
+}
+
+func (p pocsagPage) String() string {
+	address := strconv.Itoa(p.Capcode)
+	if p.Function != nil {
+		address += fmt.Sprintf("/%d", *p.Function)
+	}
+	if p.Message == "" {
+		return address + " tone only"
+	}
+	return fmt.Sprintf("%s %s: %s", address, p.Format, p.Message)
+}
@@ -0,0 +1,15 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+func detachSignals(cmd *exec.Cmd) {}
+
+func recordToggleSignal() (os.Signal, string) {
+	return nil, ""
+}
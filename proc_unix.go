@@ -0,0 +1,22 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// detachSignals starts cmd in a process group of its own, so Ctrl-C on the
+// terminal interrupts only this process, which then stops cmd itself.
+func detachSignals(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// recordToggleSignal is the signal -record-signal listens for, and its
+// name.
+func recordToggleSignal() (os.Signal, string) {
+	return syscall.SIGUSR1, "SIGUSR1"
+}
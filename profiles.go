@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sync"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// serverProfile is an SDR profile the server offers, identified as
+// "sdr|profile".
+type serverProfile struct {
+	ID   string
+	Name string
+}
+
+var (
+	profilesMu      sync.Mutex
+	serverProfiles  []serverProfile
+	selectedProfile string
+)
+
+func currentProfiles() []serverProfile {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+
+	return serverProfiles
+}
+
+func handleProfiles(list []owrx.Profile) {
+	var profiles []serverProfile
+	for _, p := range list {
+		if p.ID != "" {
+			profiles = append(profiles, serverProfile{ID: p.ID, Name: p.Name})
+		}
+	}
+
+	profilesMu.Lock()
+	serverProfiles = profiles
+	selected := selectedProfile
+	profilesMu.Unlock()
+
+	if selected != "" && profileName(selected) == selected {
+		errorf("the server has no profile %q", selected)
+	}
+
+	active := currentReceiver().ProfileID
+	infof("Available profiles:")
+	for _, p := range profiles {
+		marker := " "
+		if p.ID == active {
+			marker = "*"
+		}
+		infof(" %s %s (%s)", marker, p.Name, p.ID)
+	}
+}
+
+func profileName(id string) string {
+	for _, p := range currentProfiles() {
+		if p.ID == id {
+			return p.Name
+		}
+	}
+	return id
+}
+
+// logProfileChange reports the active profile when a config message
+// switches to a different one or retunes it.
+func logProfileChange(before, after receiverState) {
+	if after.CenterFreq == 0 || (before.ProfileID == after.ProfileID && before.CenterFreq == after.CenterFreq && before.SampleRate == after.SampleRate) {
+		return
+	}
+
+	name := profileName(after.ProfileID)
+	if name == "" {
+		name = "unknown"
+	}
+	infof("Profile %s: center %.4f MHz, bandwidth %.3f MHz", name, float64(after.CenterFreq)/1e6, float64(after.SampleRate)/1e6)
+}
+
+// useProfile selects the server profile id, now if connected and on every
+// later connection, so the choice survives a reconnect.
+func useProfile(id string) {
+	profilesMu.Lock()
+	selectedProfile = id
+	profilesMu.Unlock()
+
+	if err := client.SelectProfile(id); err != nil {
+		errorf("selecting profile: %v", err)
+	}
+}
+
+// switchProfile steps dir places through the server's profiles from the
+// active one and selects it.
+func switchProfile(dir int) {
+	profiles := currentProfiles()
+	if len(profiles) == 0 {
+		return
+	}
+
+	active := currentReceiver().ProfileID
+	i := 0
+	for j, p := range profiles {
+		if p.ID == active {
+			i = j
+		}
+	}
+	next := profiles[((i+dir)%len(profiles)+len(profiles))%len(profiles)]
+
+	infof("Switching to profile %s", next.Name)
+	useProfile(next.ID)
+}
+
+// profilePending reports whether a selected profile has yet to replace the
+// one r describes, so tuning can wait for its config.
+func profilePending(r receiverState) bool {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+
+	return selectedProfile != "" && selectedProfile != r.ProfileID
+}
@@ -0,0 +1,34 @@
+package main
+
+// Rates the OpenWebRX audio chain is built for, matching what its web
+// client requests. Anything else is coerced to the closest supported rate.
+var (
+	supportedOutputRates   = []int{8000, 11025, 12000}
+	supportedHDOutputRates = []int{22050, 24000, 32000, 44100, 48000}
+)
+
+func validateOutputRates() {
+	*outputRate = coerceRate("rate", *outputRate, supportedOutputRates)
+	*hdOutputRate = coerceRate("hdrate", *hdOutputRate, supportedHDOutputRates)
+}
+
+func coerceRate(name string, rate int, supported []int) int {
+	closest := supported[0]
+	for _, r := range supported {
+		if abs(r-rate) < abs(closest-rate) {
+			closest = r
+		}
+	}
+
+	if closest != rate {
+		warnf("-%s %d is not supported, using %d (supported: %v)", name, rate, closest, supported)
+	}
+	return closest
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// receiverState is what the server has told us about the active profile.
+type receiverState struct {
+	ProfileID    string
+	CenterFreq   int64
+	SampleRate   int64
+	WaterfallMin float32
+	WaterfallMax float32
+	waterfallSet bool
+}
+
+var (
+	receiverMu sync.Mutex
+	receiver   receiverState
+)
+
+func currentReceiver() receiverState {
+	receiverMu.Lock()
+	defer receiverMu.Unlock()
+
+	return receiver
+}
+
+func updateReceiver(config owrx.Config) {
+	receiverMu.Lock()
+	defer receiverMu.Unlock()
+
+	if config.ProfileID != nil {
+		receiver.ProfileID = *config.ProfileID
+		if config.SDRID != nil && !strings.Contains(*config.ProfileID, "|") {
+			receiver.ProfileID = *config.SDRID + "|" + *config.ProfileID
+		}
+	}
+	if config.CenterFreq != nil {
+		receiver.CenterFreq = *config.CenterFreq
+	}
+	if config.SampleRate != nil {
+		receiver.SampleRate = *config.SampleRate
+	}
+	if levels := config.WaterfallLevels; levels != nil {
+		receiver.WaterfallMin = float32(levels.Min)
+		receiver.WaterfallMax = float32(levels.Max)
+		receiver.waterfallSet = true
+	}
+}
+
+// waterfallRange is the dB range the operator configured for the
+// waterfall, or a generic default if the server didn't send one.
+func (r receiverState) waterfallRange() (low, high float32) {
+	if r.waterfallSet {
+		return r.WaterfallMin, r.WaterfallMax
+	}
+	return defaultWaterfallMin, defaultWaterfallMax
+}
+
+// binFrequency returns the approximate absolute frequency of FFT bin i out
+// of n, the bins spanning the sample rate around the center frequency.
+func (r receiverState) binFrequency(i, n int) int64 {
+	if n == 0 {
+		return r.CenterFreq
+	}
+	return r.CenterFreq + int64(float64(r.SampleRate)*(float64(i)/float64(n)-0.5))
+}
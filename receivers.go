@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+var (
+	// receiverLabels are the entries of the -config file's receivers when
+	// no -receiver was given, and receiverEntries their settings, which
+	// runReceivers then runs all at once.
+	receiverLabels  []string
+	receiverEntries map[string]map[string]interface{}
+)
+
+// receiverSettings are the settings that can differ between the receivers
+// runReceivers runs: where to connect, what to listen to and where to
+// record it. Given at the top level they apply to every receiver.
+var receiverSettings = map[string]bool{
+	"addr":       true,
+	"profile-id": true,
+	"freq":       true,
+	"offset":     true,
+	"mod":        true,
+	"lowcut":     true,
+	"highcut":    true,
+	"sq":         true,
+	"o":          true,
+}
+
+// sharedSettings are the other settings runReceivers takes, which apply to
+// every receiver alike. The rest drive something there is only one of,
+// such as the player, the API or the terminal, and need -receiver.
+var sharedSettings = map[string]bool{
+	"config":          true,
+	"log-level":       true,
+	"log-json":        true,
+	"metrics-addr":    true,
+	"tls":             true,
+	"insecure":        true,
+	"path":            true,
+	"user":            true,
+	"pass":            true,
+	"header":          true,
+	"connect-timeout": true,
+	"ping-interval":   true,
+	"ping-timeout":    true,
+	"reconnect":       true,
+	"reconnect-max":   true,
+	"backoff-base":    true,
+	"backoff-max":     true,
+	"dry-run":         true,
+	"rate":            true,
+	"hdrate":          true,
+	"rotate-duration": true,
+	"rotate-size":     true,
+}
+
+// configReceiver is one of the receivers run by runReceivers, with a
+// client and a recording of its own.
+type configReceiver struct {
+	label     string
+	addr      string
+	profileID string
+	freq      int64
+	offset    int
+	mode      owrx.Mode
+	lowCut    int
+	highCut   int
+	squelch   int
+	output    string
+
+	client *owrx.Client
+
+	mu         sync.Mutex
+	rec        *recording
+	center     int64
+	connected  bool
+	reconnects uint64
+	messages   map[string]uint64
+	smeter     float64
+	smeterSeen bool
+}
+
+// runReceivers connects to every receiver in the -config file at once and
+// waits for them all to stop. Each has its own client and recording; log
+// lines carry the receiver's label and, with -metrics-addr, their metrics
+// are served together, labelled the same.
+func runReceivers() {
+	checkSharedSettings()
+
+	var receivers []*configReceiver
+	for _, label := range receiverLabels {
+		r, err := newReceiver(label, receiverEntries[label])
+		if err != nil {
+			fatalf("Receiver %s: %v", label, err)
+		}
+		receivers = append(receivers, r)
+	}
+
+	ctx, stop := setupInterruptHandler()
+	defer stop()
+
+	server := serveReceiverMetrics(receivers)
+
+	var running []*configReceiver
+	for _, r := range receivers {
+		if err := r.open(); err != nil {
+			r.logf(levelError, "%v", err)
+			exitStatus = 1
+			continue
+		}
+		running = append(running, r)
+	}
+
+	var wg sync.WaitGroup
+	failed := make(chan string, len(running))
+	for _, r := range running {
+		wg.Add(1)
+		go func(r *configReceiver) {
+			defer wg.Done()
+			err := r.client.Run(ctx)
+			r.close()
+			if err != nil {
+				r.logf(levelError, "Stopped: %v", err)
+				failed <- r.label
+				return
+			}
+			r.logf(levelInfo, "Stopped")
+		}(r)
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		exitStatus = 1
+	}
+
+	if server != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		server.Shutdown(shutdownCtx)
+		cancel()
+	}
+}
+
+// checkSharedSettings stops with an error when a setting that can't be
+// shared between the receivers is given.
+func checkSharedSettings() {
+	flag.Visit(func(f *flag.Flag) {
+		if !receiverSettings[f.Name] && !sharedSettings[f.Name] {
+			fatalf("-%s needs a single receiver, pick one with -receiver", f.Name)
+		}
+	})
+}
+
+// newReceiver resolves the settings of the receiver label: those of its
+// entry over the top-level ones, except where the command line or the
+// environment set them. A top-level -o is given the label, so the
+// receivers don't share a recording.
+func newReceiver(label string, entry map[string]interface{}) (*configReceiver, error) {
+	r := &configReceiver{label: label, messages: make(map[string]uint64)}
+	var modName string
+	freq := newFrequency(int64(*tuneFreq))
+
+	settings := flag.NewFlagSet(label, flag.ContinueOnError)
+	settings.SetOutput(io.Discard)
+	settings.StringVar(&r.addr, "addr", *addr, "")
+	settings.StringVar(&r.profileID, "profile-id", *profileID, "")
+	settings.Var(freq, "freq", "")
+	settings.IntVar(&r.offset, "offset", *freqOffset, "")
+	settings.StringVar(&modName, "mod", *mod, "")
+	settings.IntVar(&r.lowCut, "lowcut", *lowCut, "")
+	settings.IntVar(&r.highCut, "highcut", *highCut, "")
+	settings.IntVar(&r.squelch, "sq", *squelch, "")
+	settings.StringVar(&r.output, "o", *output, "")
+
+	for _, name := range profileNames(entry) {
+		switch {
+		case sharedSettings[name]:
+			return nil, fmt.Errorf("%q applies to all receivers, set it at the top level", name)
+		case !receiverSettings[name]:
+			return nil, fmt.Errorf("%q needs a single receiver, run this one with -receiver %s", name, label)
+		}
+		if pinnedFlags[name] {
+			continue
+		}
+		if err := settings.Set(name, configString(entry[name])); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	set := explicitFlags()
+	own := make(map[string]bool)
+	settings.Visit(func(f *flag.Flag) {
+		own[f.Name] = true
+	})
+
+	mode, ok := owrx.FindMode(modName)
+	if !ok {
+		return nil, fmt.Errorf("unknown mod %q, known modes: %s", modName, strings.Join(owrx.ModeNames(), ", "))
+	}
+	r.mode = mode
+	if !set["lowcut"] && !own["lowcut"] {
+		r.lowCut = mode.LowCut
+	}
+	if !set["highcut"] && !own["highcut"] {
+		r.highCut = mode.HighCut
+	}
+	if r.lowCut >= r.highCut {
+		return nil, fmt.Errorf("lowcut %d must be below highcut %d", r.lowCut, r.highCut)
+	}
+
+	r.freq = int64(*freq)
+	if r.freq != 0 && (set["offset"] || own["offset"]) {
+		return nil, errors.New("freq and offset can't be used together")
+	}
+
+	switch {
+	case r.output == "-":
+		return nil, errors.New("o can't be - with several receivers, their audio would be mixed on stdout")
+	case r.output != "" && !own["o"]:
+		ext := filepath.Ext(r.output)
+		r.output = strings.TrimSuffix(r.output, ext) + "_" + label + ext
+	}
+
+	scheme, host := addrScheme(r.addr)
+	r.client = owrx.NewClient(host, append(connectionOptions(scheme),
+		owrx.WithMode(r.mode.Name),
+		owrx.WithPassband(r.lowCut, r.highCut),
+		owrx.WithOffset(r.offset),
+		owrx.WithSquelch(r.squelch),
+	)...)
+	if r.profileID != "" {
+		r.client.SelectProfile(r.profileID)
+	}
+	r.client.OnStatus(r.handleStatus)
+	r.client.OnRaw(r.handleRaw)
+	r.client.OnMessage(r.handleMessage)
+	r.client.OnSmeter(r.handleSmeter)
+	r.client.OnAudio(r.handleAudio)
+	r.client.OnError(func(err error) {
+		r.logf(levelError, "%v", err)
+	})
+	return r, nil
+}
+
+func (r *configReceiver) logf(level logLevel, format string, v ...interface{}) {
+	receiverLogf(r.label, level, format, v...)
+}
+
+// open starts the receiver's recording, if it has -o.
+func (r *configReceiver) open() error {
+	if r.output == "" {
+		return nil
+	}
+	rec, err := openRecording(r.output, false)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rec = rec
+	return nil
+}
+
+// close finalizes the receiver's recording.
+func (r *configReceiver) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rec == nil {
+		return
+	}
+	if err := r.rec.Close(); err != nil {
+		r.logf(levelError, "closing recording: %v", err)
+	}
+	r.rec = nil
+}
+
+func (r *configReceiver) handleStatus(status owrx.Status) {
+	switch status.State {
+	case owrx.StateConnecting:
+		r.logf(levelInfo, "Connecting to %s", r.client.URL())
+	case owrx.StateConnectFailed:
+		if *reconnect {
+			r.logf(levelError, "failed to connect: %v", status.Err)
+		}
+	case owrx.StateConnected:
+		r.setConnected(true)
+	case owrx.StateDisconnected:
+		r.setConnected(false)
+		r.logf(levelInfo, "Connection closed")
+	case owrx.StateWaiting:
+		r.logf(levelInfo, "Reconnecting in %v (attempt %d)", status.Delay, status.Attempt)
+		r.mu.Lock()
+		r.reconnects++
+		r.mu.Unlock()
+	case owrx.StateClosing:
+		r.setConnected(false)
+		r.logf(levelInfo, "Interrupt received, closing connection")
+	}
+}
+
+func (r *configReceiver) setConnected(connected bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.connected = connected
+	if !connected {
+		r.center = 0
+	}
+}
+
+func (r *configReceiver) handleRaw(messageType int, message []byte) {
+	if len(message) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.messages[messageKind(messageType, message)]++
+}
+
+// handleMessage tunes to -freq whenever the profile's center frequency
+// changes.
+func (r *configReceiver) handleMessage(msg owrx.Message) {
+	config, ok := msg.(*owrx.ConfigMessage)
+	if !ok || config.Value.CenterFreq == nil || r.freq == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	changed := *config.Value.CenterFreq != r.center
+	r.center = *config.Value.CenterFreq
+	r.mu.Unlock()
+	if !changed {
+		return
+	}
+	if err := r.client.SetFrequency(r.freq); err != nil {
+		r.logf(levelError, "freq: %v", err)
+		return
+	}
+	r.logf(levelInfo, "Tuned to %s", formatMHz(r.freq))
+}
+
+func (r *configReceiver) handleSmeter(value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.smeter = value
+	r.smeterSeen = true
+}
+
+func (r *configReceiver) handleAudio(frame owrx.AudioFrame) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rec == nil {
+		return
+	}
+	if err := r.rec.WriteAudio(frame); err != nil {
+		r.logf(levelError, "recording: %v, stopping it", err)
+		r.rec.Close()
+		r.rec = nil
+	}
+}
+
+// serveReceiverMetrics serves the metrics of all receivers on -metrics-addr.
+func serveReceiverMetrics(receivers []*configReceiver) *http.Server {
+	if *metricsAddr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		serveReceiverMetricsPage(w, receivers)
+	})
+	listener, err := net.Listen("tcp", *metricsAddr)
+	if err != nil {
+		fatalf("Metrics server: %v", err)
+	}
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			errorf("Metrics server: %v", err)
+		}
+	}()
+	infof("Serving metrics on http://%s/metrics", *metricsAddr)
+	return server
+}
+
+func serveReceiverMetricsPage(w http.ResponseWriter, receivers []*configReceiver) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	for _, r := range receivers {
+		r.mu.Lock()
+	}
+	defer func() {
+		for _, r := range receivers {
+			r.mu.Unlock()
+		}
+	}()
+
+	writeMetricHeader(w, "owrxp_messages_total", "counter", "Messages received from the server by receiver and type.")
+	for _, r := range receivers {
+		for _, kind := range sortedKeys(r.messages) {
+			fmt.Fprintf(w, "owrxp_messages_total{receiver=%q,type=%q} %d\n", r.label, kind, r.messages[kind])
+		}
+	}
+	writeMetricHeader(w, "owrxp_smeter", "gauge", "Latest smeter reading of each receiver as linear power.")
+	for _, r := range receivers {
+		if r.smeterSeen {
+			fmt.Fprintf(w, "owrxp_smeter{receiver=%q} %g\n", r.label, r.smeter)
+		}
+	}
+	writeMetricHeader(w, "owrxp_reconnects_total", "counter", "Reconnect attempts of each receiver.")
+	for _, r := range receivers {
+		fmt.Fprintf(w, "owrxp_reconnects_total{receiver=%q} %d\n", r.label, r.reconnects)
+	}
+	writeMetricHeader(w, "owrxp_connected", "gauge", "Whether each receiver is connected to its server.")
+	for _, r := range receivers {
+		fmt.Fprintf(w, "owrxp_connected{receiver=%q} %d\n", r.label, boolMetric(r.connected))
+	}
+}
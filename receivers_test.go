@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestNewReceiver(t *testing.T) {
+	*output = "rec_%H%M.wav"
+	defer func() { *output = "" }()
+
+	r, err := newReceiver("local", map[string]interface{}{"mod": "usb", "freq": "7.074M"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.output != "rec_%H%M_local.wav" {
+		t.Errorf("output = %q, want the top-level -o with the label", r.output)
+	}
+	if r.mode.Name != "usb" || r.lowCut != r.mode.LowCut || r.highCut != r.mode.HighCut {
+		t.Errorf("mode %s %d..%d, want usb with its default passband", r.mode.Name, r.lowCut, r.highCut)
+	}
+	if r.freq != 7074000 {
+		t.Errorf("freq = %d, want 7074000", r.freq)
+	}
+
+	r, err = newReceiver("own", map[string]interface{}{"o": "own.wav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.output != "own.wav" {
+		t.Errorf("output = %q, want the entry's own", r.output)
+	}
+}
+
+func TestNewReceiverRejects(t *testing.T) {
+	for name, entry := range map[string]map[string]interface{}{
+		"single only": {"api-addr": "localhost:8080"},
+		"shared":      {"rate": 12000},
+		"stdout":      {"o": "-"},
+		"mode":        {"mod": "nope"},
+		"cuts":        {"lowcut": 3000, "highcut": 300},
+		"freq offset": {"freq": "145.5M", "offset": 1000},
+	} {
+		if _, err := newReceiver("r", entry); err == nil {
+			t.Errorf("%s: newReceiver(%v) succeeded, want an error", name, entry)
+		}
+	}
+}
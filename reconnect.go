@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/gorilla/websocket"
+	"net.wadon/owrxp-playground/owrx"
+)
+
+func logReadError(err error) {
+	// 1006 is synthesized locally when the connection drops without a
+	// close frame, so it isn't reported as coming from the server.
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) && closeErr.Code != websocket.CloseAbnormalClosure {
+		infof("Server closed: %d %s", closeErr.Code, closeText(closeErr))
+		return
+	}
+	errorf("reading message: %v", err)
+}
+
+func closeText(err *websocket.CloseError) string {
+	if err.Text != "" {
+		return err.Text
+	}
+	switch err.Code {
+	case websocket.CloseNormalClosure:
+		return "normal closure"
+	case websocket.CloseGoingAway:
+		return "going away"
+	case websocket.ClosePolicyViolation:
+		return "policy violation"
+	case websocket.CloseInternalServerErr:
+		return "internal server error"
+	case websocket.CloseServiceRestart:
+		return "service restart"
+	case websocket.CloseTryAgainLater:
+		return "try again later"
+	}
+	return "no reason given"
+}
+
+// logBackoff reports a backoff message, which OpenWebRX sends right before
+// closing the connection when it is busy, e.g. has too many users. The
+// client waits -backoff-max before reconnecting.
+func logBackoff(msg *owrx.BackoffMessage) {
+	reason := msg.Reason
+	if reason == "" {
+		reason = "no reason given"
+	}
+	warnf("Server asked us to back off: %s", reason)
+}
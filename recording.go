@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// recording is a WAV output that rolls over to a new file once the
+// rotation duration or size is reached. The finished file is finalized
+// before the next one is opened.
+type recording struct {
+	template    string
+	segmented   bool
+	maxDuration time.Duration
+	maxSize     int64
+	wav         *wavWriter
+	sidecar     *recordingSidecar
+}
+
+func openRecording(template string, segmented bool) (*recording, error) {
+	r := &recording{
+		template:    template,
+		segmented:   segmented || *rotateDuration > 0 || *rotateSize > 0,
+		maxDuration: *rotateDuration,
+		maxSize:     int64(*rotateSize),
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *recording) open() error {
+	name := recordingName(r.template, time.Now(), r.segmented)
+	wav, err := createWAV(name)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+
+	infof("Recording to %s", name)
+	r.wav = wav
+	r.sidecar = newSidecar(name)
+	return nil
+}
+
+// closeFile finalizes the current file and its sidecar.
+func (r *recording) closeFile() error {
+	duration, rate := r.wav.duration(), r.wav.rate
+	err := r.wav.Close()
+	r.wav = nil
+	r.sidecar.finish(duration, rate)
+	r.sidecar = nil
+	return err
+}
+
+func (r *recording) full() bool {
+	if r.maxSize > 0 && int64(r.wav.dataSize)+wavHeaderSize >= r.maxSize {
+		return true
+	}
+	return r.maxDuration > 0 && r.wav.duration() >= r.maxDuration
+}
+
+func (r *recording) WriteAudio(frame owrx.AudioFrame) error {
+	if r.wav == nil {
+		return nil
+	}
+
+	if r.full() {
+		if err := r.closeFile(); err != nil {
+			errorf("closing recording: %v", err)
+		}
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+
+	return r.wav.WriteAudio(frame)
+}
+
+func (r *recording) Close() error {
+	if r.wav == nil {
+		return nil
+	}
+	return r.closeFile()
+}
+
+// byteSize is a flag value accepting sizes such as 500K, 100M or 2G.
+type byteSize int64
+
+func (s *byteSize) String() string {
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+func (s *byteSize) Set(value string) error {
+	multiplier := int64(1)
+	number := strings.TrimSuffix(strings.ToUpper(value), "B")
+	if n := len(number); n > 0 {
+		switch number[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			number = number[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", value)
+	}
+	*s = byteSize(n * multiplier)
+	return nil
+}
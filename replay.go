@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+const (
+	// replayAudioChunk is how much of a WAV file goes into each audio frame.
+	replayAudioChunk = 100 * time.Millisecond
+	// maxReplayRecord bounds a record of an -fft-record file, so a corrupt
+	// length doesn't allocate the memory it names.
+	maxReplayRecord = 16 << 20
+	maxReplayLine   = 16 << 20
+)
+
+// replayFlags collects repeated -replay files.
+type replayFlags []string
+
+func (f *replayFlags) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *replayFlags) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+var (
+	replayFiles replayFlags
+
+	// replayMu keeps the files played together from running the handlers
+	// at once, which a connection's single reader never does.
+	replayMu sync.Mutex
+)
+
+func validateReplay() {
+	if len(replayFiles) == 0 {
+		return
+	}
+	switch {
+	case *replaySpeed < 0:
+		fatalf("-speed must not be negative, use 0 to replay as fast as possible")
+	case *scanStart != 0 || *scanList != "":
+		fatalf("-replay can't scan, there is no receiver to tune")
+	}
+}
+
+// runReplay plays the -replay files through the client's handlers, as if a
+// server had sent them, instead of connecting. Several files play side by
+// side, e.g. an -fft-record file and a recording of the same session.
+func runReplay(ctx context.Context) {
+	var wg sync.WaitGroup
+	var failedMu sync.Mutex
+	failed := 0
+	start := time.Now()
+	for _, path := range replayFiles {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			infof("Replaying %s", path)
+			if err := replayFile(ctx, path, &replayClock{start: start}); err != nil {
+				errorf("Replaying %s: %v", path, err)
+				failedMu.Lock()
+				failed++
+				failedMu.Unlock()
+			}
+		}(path)
+	}
+	wg.Wait()
+
+	switch {
+	case ctx.Err() != nil:
+		infof("Interrupt received, stopping the replay")
+	case failed > 0:
+		exitStatus = 1
+	default:
+		infof("Replay finished")
+	}
+}
+
+// replayClock paces a file to -speed: each frame is passed on once as much
+// time has gone by since the start, sped up, as since the file's first.
+type replayClock struct {
+	start time.Time
+	first time.Time
+	set   bool
+}
+
+func (c *replayClock) wait(ctx context.Context, t time.Time) error {
+	if !c.set {
+		c.first, c.set = t, true
+	}
+	if *replaySpeed == 0 {
+		return ctx.Err()
+	}
+
+	due := c.start.Add(time.Duration(float64(t.Sub(c.first)) / *replaySpeed))
+	timer := time.NewTimer(time.Until(due))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// replayFile plays one file, telling its kind from how it starts: an
+// -fft-record file, a WAV recording, or else a -json dump.
+func replayFile(ctx context.Context, path string, clock *replayClock) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, _ := r.Peek(len(fftRecordMagic))
+	switch {
+	case string(magic) == fftRecordMagic:
+		err = replayFFT(ctx, r, clock)
+	case bytes.HasPrefix(magic, []byte("RIFF")):
+		err = replayWAV(ctx, r, clock)
+	default:
+		err = replayJSON(ctx, r)
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+func feed(f func()) {
+	replayMu.Lock()
+	defer replayMu.Unlock()
+
+	f()
+}
+
+// replayFFT plays an -fft-record file. Each header becomes a config message
+// with the band and waterfall levels it describes; a file cut short, as by
+// a crash, plays up to where it ends.
+func replayFFT(ctx context.Context, r *bufio.Reader, clock *replayClock) error {
+	r.Discard(len(fftRecordMagic))
+
+	for {
+		var prefix [4]byte
+		if _, err := io.ReadFull(r, prefix[:]); err != nil {
+			return replayEnd(err)
+		}
+		length := binary.LittleEndian.Uint32(prefix[:])
+		if length == 0 || length > maxReplayRecord {
+			return fmt.Errorf("corrupt record of %d bytes", length)
+		}
+		record := make([]byte, length)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return replayEnd(err)
+		}
+
+		kind, payload := record[0], record[1:]
+		switch kind {
+		case fftRecordHeader:
+			if len(payload) < fftHeaderSize {
+				return fmt.Errorf("short header of %d bytes", len(payload))
+			}
+			config, err := replayConfig(payload)
+			if err != nil {
+				return err
+			}
+			feed(func() { client.Feed(websocket.TextMessage, config) })
+		case fftRecordFrame:
+			if len(payload) < 8 || (len(payload)-8)%4 != 0 {
+				return fmt.Errorf("frame of %d bytes isn't whole bins", len(payload))
+			}
+			t := time.Unix(0, int64(binary.LittleEndian.Uint64(payload)))
+			bins := make([]float32, (len(payload)-8)/4)
+			for i := range bins {
+				bins[i] = math.Float32frombits(binary.LittleEndian.Uint32(payload[8+4*i:]))
+			}
+			if err := clock.wait(ctx, t); err != nil {
+				return err
+			}
+			feed(func() { client.FeedFFT(bins) })
+		}
+	}
+}
+
+// replayConfig turns a header record into the config message a server
+// would have sent.
+func replayConfig(header []byte) ([]byte, error) {
+	value := map[string]interface{}{
+		"samp_rate":   binary.LittleEndian.Uint32(header[4:]),
+		"center_freq": int64(binary.LittleEndian.Uint64(header[8:])),
+	}
+	low := math.Float32frombits(binary.LittleEndian.Uint32(header[24:]))
+	high := math.Float32frombits(binary.LittleEndian.Uint32(header[28:]))
+	if !math.IsNaN(float64(low)) && !math.IsNaN(float64(high)) {
+		value["waterfall_levels"] = map[string]float32{"min": low, "max": high}
+	}
+	return json.Marshal(map[string]interface{}{"type": "config", "value": value})
+}
+
+// replayEnd is the end of a file: clean at a record boundary, and with a
+// warning when the last record is cut short.
+func replayEnd(err error) error {
+	switch err {
+	case io.EOF:
+		return nil
+	case io.ErrUnexpectedEOF:
+		warnf("Replay: the file ends in the middle of a record")
+		return nil
+	}
+	return err
+}
+
+// replayWAV plays a mono 16-bit PCM WAV file, such as an -o recording, as
+// audio frames at the file's rate.
+func replayWAV(ctx context.Context, r *bufio.Reader, clock *replayClock) error {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil || string(riff[8:]) != "WAVE" {
+		return errors.New("not a WAV file")
+	}
+
+	rate := 0
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return errors.New("no audio data in the WAV file")
+		}
+		id, size := string(chunk[:4]), binary.LittleEndian.Uint32(chunk[4:])
+
+		switch id {
+		case "fmt ":
+			if size < 16 || size > 1024 {
+				return errors.New("corrupt WAV format chunk")
+			}
+			format := make([]byte, size)
+			if _, err := io.ReadFull(r, format); err != nil {
+				return errors.New("corrupt WAV format chunk")
+			}
+			pcm := binary.LittleEndian.Uint16(format[0:]) == 1
+			channels := binary.LittleEndian.Uint16(format[2:])
+			bits := binary.LittleEndian.Uint16(format[14:])
+			if !pcm || channels != 1 || bits != 16 {
+				return errors.New("only mono 16-bit PCM WAV files can be replayed")
+			}
+			rate = int(binary.LittleEndian.Uint32(format[4:]))
+		case "data":
+			if rate <= 0 {
+				return errors.New("WAV data before its format")
+			}
+			// A recording that wasn't closed may say it holds less than it
+			// does, so the data is read to the end of the file.
+			return replayAudio(ctx, r, rate, clock)
+		default:
+			if _, err := r.Discard(int(size + size%2)); err != nil {
+				return errors.New("corrupt WAV file")
+			}
+		}
+	}
+}
+
+func replayAudio(ctx context.Context, r io.Reader, rate int, clock *replayClock) error {
+	samplesPerFrame := int(int64(rate) * int64(replayAudioChunk) / int64(time.Second))
+	buf := make([]byte, 2*samplesPerFrame)
+	var played int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n >= 2 {
+			samples := make([]int16, n/2)
+			for i := range samples {
+				samples[i] = int16(binary.LittleEndian.Uint16(buf[2*i:]))
+			}
+			if err := clock.wait(ctx, time.Unix(0, 0).Add(time.Duration(played)*time.Second/time.Duration(rate))); err != nil {
+				return err
+			}
+			feed(func() { client.FeedAudio(owrx.AudioFrame{Samples: samples, Rate: rate}) })
+			played += int64(len(samples))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// replayJSON plays the messages of a -json dump. The dump has no times for
+// them, so they are passed on one after the other, whatever -speed says.
+// Binary messages are left out, as the dump only has their sizes, and so
+// are the events, which come from the messages and are made again.
+func replayJSON(ctx context.Context, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxReplayLine)
+
+	skipped := 0
+	for line := 1; scanner.Scan(); line++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data := scanner.Bytes()
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+
+		var record struct {
+			Type  string          `json:"type"`
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		switch record.Type {
+		case "binary":
+			skipped++
+			continue
+		case "event":
+			continue
+		case "text":
+			var text string
+			if err := json.Unmarshal(record.Value, &text); err != nil {
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+			data = []byte(text)
+		}
+		message := append([]byte(nil), data...)
+		feed(func() { client.Feed(websocket.TextMessage, message) })
+	}
+	if skipped > 0 {
+		debugf("Replay: left out %d binary messages, which the JSON dump has no data for", skipped)
+	}
+	return scanner.Err()
+}
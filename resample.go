@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"sync"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// resampler converts a mono stream between sample rates by linear
+// interpolation. Its position and last sample carry over between frames so
+// block boundaries don't click.
+type resampler struct {
+	from, to int
+	pos      float64
+	last     int16
+	primed   bool
+}
+
+func newResampler(from, to int) *resampler {
+	return &resampler{from: from, to: to}
+}
+
+func (r *resampler) process(in []int16) []int16 {
+	if len(in) == 0 {
+		return nil
+	}
+	if !r.primed {
+		r.last = in[0]
+		r.primed = true
+	}
+
+	step := float64(r.from) / float64(r.to)
+	out := make([]int16, 0, int(float64(len(in))/step)+1)
+
+	// Index -1 refers to the last sample of the previous frame.
+	sample := func(i int) float64 {
+		if i < 0 {
+			return float64(r.last)
+		}
+		return float64(in[i])
+	}
+
+	n := float64(len(in))
+	for r.pos < n-1 {
+		i := int(math.Floor(r.pos))
+		frac := r.pos - float64(i)
+		v := sample(i) + (sample(i+1)-sample(i))*frac
+		out = append(out, int16(math.Round(v)))
+		r.pos += step
+	}
+
+	r.pos -= n
+	r.last = in[len(in)-1]
+
+	return out
+}
+
+var (
+	resamplersMu sync.Mutex
+	resamplers   = map[bool]*resampler{}
+)
+
+// resampleFrame applies the -resample stage. The normal and HD streams keep
+// separate resampler state.
+func resampleFrame(frame owrx.AudioFrame) owrx.AudioFrame {
+	if *resample <= 0 || frame.Rate == *resample || frame.Rate == 0 {
+		return frame
+	}
+
+	resamplersMu.Lock()
+	defer resamplersMu.Unlock()
+
+	r := resamplers[frame.HD]
+	if r == nil || r.from != frame.Rate {
+		r = newResampler(frame.Rate, *resample)
+		resamplers[frame.HD] = r
+	}
+
+	frame.Samples = r.process(frame.Samples)
+	frame.Rate = *resample
+	return frame
+}
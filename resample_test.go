@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestResamplerKeepsFrequency resamples a second of a 1 kHz tone from 12 to
+// 48 kHz in frames, as it arrives from the server, and checks the tone is
+// still at 1 kHz: as many zero crossings and the same Goertzel peak.
+func TestResamplerKeepsFrequency(t *testing.T) {
+	const from, to, tone, frameSize = 12000, 48000, 1000.0, 240
+
+	in := make([]int16, from)
+	for i := range in {
+		in[i] = int16(math.Round(16000 * math.Sin(2*math.Pi*tone*float64(i)/from)))
+	}
+
+	r := newResampler(from, to)
+	var out []int16
+	for i := 0; i < len(in); i += frameSize {
+		out = append(out, r.process(in[i:i+frameSize])...)
+	}
+
+	if n := len(out); n < to-8 || n > to {
+		t.Fatalf("%d samples out of a second at %d Hz, want about %d", n, from, to)
+	}
+
+	crossings := 0
+	for i := 1; i < len(out); i++ {
+		if (out[i-1] < 0) != (out[i] < 0) {
+			crossings++
+		}
+	}
+	if crossings < 2*tone-2 || crossings > 2*tone+2 {
+		t.Errorf("%d zero crossings in a second, want %v for %v Hz", crossings, 2*tone, tone)
+	}
+
+	power := goertzel(out, to, tone)
+	for _, other := range []float64{tone - 50, tone + 50, 2 * tone, 3 * tone} {
+		if p := goertzel(out, to, other); p > power/100 {
+			t.Errorf("power at %v Hz is %.3g, want well below the %.3g at %v Hz", other, p, power, tone)
+		}
+	}
+}
+
+// goertzel returns the power of samples at freq.
+func goertzel(samples []int16, rate int, freq float64) float64 {
+	coeff := 2 * math.Cos(2*math.Pi*freq/float64(rate))
+	var s1, s2 float64
+	for _, v := range samples {
+		s0 := float64(v) + coeff*s1 - s2
+		s2, s1 = s1, s0
+	}
+	return s1*s1 + s2*s2 - coeff*s1*s2
+}
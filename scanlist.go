@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// scanChannel is a channel the scanner stops on. A -scan-list entry may
+// set its own mode and squelch level; the others use the ones the scan
+// started with.
+type scanChannel struct {
+	Frequency int64
+	Name      string
+	Mode      string
+	Squelch   *int
+}
+
+func (c scanChannel) String() string {
+	if c.Name == "" {
+		return formatMHz(c.Frequency)
+	}
+	return formatMHz(c.Frequency) + " " + c.Name
+}
+
+// readScanList reads a -scan-list file: CSV lines of frequency, mode,
+// squelch and name, of which all but the frequency may be left empty or
+// out, e.g.
+//
+//	145.5M,nfm,-90,Calling
+//	118.1M,am,,"Tower, north"
+//	433.5M
+//
+// Lines starting with # are comments, and a first line starting with
+// "frequency" is taken for a header.
+func readScanList(path string) ([]scanChannel, error) {
+	channels, err := readChannels(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("%s: no channels", path)
+	}
+	if len(channels) > maxScanChannels {
+		return nil, fmt.Errorf("%s: more than %d channels", path, maxScanChannels)
+	}
+	return channels, nil
+}
+
+// readChannels reads a file of channels in the -scan-list format, which
+// -memory files share.
+func readChannels(path string) ([]scanChannel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var channels []scanChannel
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), "frequency") {
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		channel, err := parseScanChannel(record)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
+
+func parseScanChannel(record []string) (scanChannel, error) {
+	field := func(i int) string {
+		if i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var channel scanChannel
+	if len(record) > 4 {
+		return channel, fmt.Errorf("%d fields, a name with commas needs quotes", len(record))
+	}
+
+	var freq frequency
+	if err := freq.Set(field(0)); err != nil || freq == 0 {
+		return channel, fmt.Errorf("invalid frequency %q", field(0))
+	}
+	channel.Frequency = int64(freq)
+
+	if mode := field(1); mode != "" {
+		if _, ok := owrx.FindMode(mode); !ok {
+			return channel, fmt.Errorf("unknown mode %q, known modes: %s", mode, strings.Join(owrx.ModeNames(), ", "))
+		}
+		channel.Mode = mode
+	}
+
+	if sq := field(2); sq != "" {
+		level, err := strconv.Atoi(sq)
+		if err != nil || level < minSquelch || level > maxSquelch {
+			return channel, fmt.Errorf("invalid squelch %q, use %d to %d dB", sq, minSquelch, maxSquelch)
+		}
+		channel.Squelch = &level
+	}
+
+	channel.Name = field(3)
+	return channel, nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+const (
+	maxScanChannels = 100000
+
+	// scanSettle is how long smeter readings are ignored after retuning,
+	// as the first ones may still describe the previous channel.
+	scanSettle = 150 * time.Millisecond
+
+	// priorityLook is how long a -priority check listens once settled, so
+	// each check takes the scan away for scanSettle plus priorityLook.
+	priorityLook = 200 * time.Millisecond
+)
+
+// scanHit sums up the activity found on one channel.
+type scanHit struct {
+	Count int
+	Total time.Duration
+	Peak  float64
+}
+
+// scanner steps through -scan-start to -scan-stop, or the channels of a
+// -scan-list, listening on each channel for -dwell and holding on it while
+// the squelch is open and for -hold after it closes.
+type scanner struct {
+	mu       sync.Mutex
+	channels []scanChannel
+	index    int
+	dwell    time.Duration
+	started  bool
+	tunedAt  time.Time
+	openedAt time.Time
+	squelch  squelchDetector
+	peak     float64
+	hits     map[int]*scanHit
+
+	// priority is the index of the -priority channel, or -1. While a check
+	// is on, the channel it interrupted and its squelch wait in resume and
+	// saved; resuming is set while holding on the priority channel after
+	// a check found it active, to return to resume once it clears.
+	priority   int
+	priorityAt time.Time
+	checking   bool
+	resuming   bool
+	resume     int
+	saved      squelchDetector
+	savedAt    time.Time
+	savedPeak  float64
+	farWarned  bool
+
+	// The mode and squelch level the scan started with, for the channels
+	// that don't set their own.
+	baseMode    string
+	baseSquelch int
+}
+
+var (
+	scan *scanner
+	// scanListChannels is the -scan-list file, read while validating the
+	// flags.
+	scanListChannels []scanChannel
+)
+
+func validateScan() {
+	if *dwellTime <= 0 {
+		fatalf("-dwell must be positive")
+	}
+	if *holdTime < 0 {
+		fatalf("-hold must not be negative")
+	}
+	validatePriority()
+
+	if *scanList != "" {
+		validateScanList()
+		return
+	}
+	if *scanStart == 0 && *scanStop == 0 {
+		return
+	}
+
+	switch {
+	case *scanStart == 0 || *scanStop == 0:
+		fatalf("-scan-start and -scan-stop must be used together")
+	case *scanStop < *scanStart:
+		fatalf("-scan-stop %s is below -scan-start %s", formatMHz(int64(*scanStop)), formatMHz(int64(*scanStart)))
+	case *scanStep <= 0:
+		fatalf("-scan-step must be positive")
+	case int64(*scanStop-*scanStart)/int64(*scanStep) >= maxScanChannels:
+		fatalf("-scan-start to -scan-stop in steps of %d Hz gives more than %d channels", int64(*scanStep), maxScanChannels)
+	case *tuneFreq != 0:
+		fatalf("-freq and -scan-start can't be used together")
+	}
+}
+
+func validatePriority() {
+	switch {
+	case *priorityFreq == 0:
+	case *scanStart == 0 && *scanList == "":
+		fatalf("-priority needs -scan-start and -scan-stop or -scan-list")
+	case *priorityEvery < minPriorityInterval:
+		fatalf("-priority-interval must be at least %v", minPriorityInterval)
+	}
+}
+
+func validateScanList() {
+	switch {
+	case *scanStart != 0 || *scanStop != 0:
+		fatalf("-scan-list can't be used with -scan-start and -scan-stop")
+	case *tuneFreq != 0:
+		fatalf("-freq and -scan-list can't be used together")
+	}
+
+	channels, err := readScanList(*scanList)
+	if err != nil {
+		fatalf("Failed to read -scan-list: %v", err)
+	}
+	scanListChannels = channels
+}
+
+func setupScanner() {
+	if *scanStart == 0 && scanListChannels == nil {
+		return
+	}
+
+	scan = &scanner{
+		dwell:   *dwellTime,
+		squelch: squelchDetector{hang: *holdTime},
+		hits:    make(map[int]*scanHit),
+
+		priority: -1,
+	}
+	if scanListChannels != nil {
+		scan.channels = scanListChannels
+		infof("Scanning %d channels from %s", len(scan.channels), *scanList)
+	} else {
+		for f := int64(*scanStart); f <= int64(*scanStop); f += int64(*scanStep) {
+			scan.channels = append(scan.channels, scanChannel{Frequency: f})
+		}
+		infof("Scanning %d channels from %s to %s", len(scan.channels), formatMHz(scan.channels[0].Frequency), formatMHz(scan.channels[len(scan.channels)-1].Frequency))
+	}
+	if *priorityFreq != 0 {
+		scan.setPriority(int64(*priorityFreq))
+	}
+
+	addSmeterHandler(scan.handleSmeter)
+}
+
+// handleSmeter follows the instantaneous level rather than the moving
+// average, which would mix in readings from the previous channel.
+func (s *scanner) handleSmeter(r smeterReading) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := r.Time
+	if !s.started {
+		if rcv := currentReceiver(); rcv.CenterFreq == 0 || profilePending(rcv) {
+			return
+		}
+		s.started = true
+		base := currentDSP()
+		s.baseMode, s.baseSquelch = base.Mod, base.SquelchLevel
+		s.priorityAt = now
+		s.tuneLocked(0, now)
+		return
+	}
+	if now.Sub(s.tunedAt) < scanSettle {
+		return
+	}
+
+	db := smeterDB(r.Value)
+	if s.checking {
+		s.checkPriorityLocked(db, now)
+		return
+	}
+	switch {
+	case s.index == s.priority:
+		// The interval counts from the last time on the priority channel.
+		s.priorityAt = now
+	case s.priority >= 0 && now.Sub(s.priorityAt) >= *priorityEvery:
+		s.startPriorityCheckLocked(now)
+		return
+	}
+
+	s.squelch.level = float64(currentDSP().SquelchLevel)
+	opened, closed := s.squelch.update(db, now)
+	switch {
+	case opened:
+		s.openedAt = now
+		s.peak = db
+		infof("Scan: signal on %s at %.1f dB", s.channels[s.index], db)
+	case s.squelch.open:
+		s.peak = math.Max(s.peak, db)
+	case closed:
+		s.recordHitLocked(s.index, s.openedAt, s.peak, now)
+		next := s.index + 1
+		if s.resuming {
+			// Back to the channel the priority channel interrupted.
+			s.resuming = false
+			next = s.resume
+		}
+		s.tuneLocked(next, now)
+	case now.Sub(s.tunedAt) >= s.dwell:
+		s.tuneLocked(s.index+1, now)
+	}
+}
+
+// tuneLocked moves to channel i, wrapping around at the end and skipping
+// channels outside the profile.
+func (s *scanner) tuneLocked(i int, now time.Time) {
+	for tries := 0; tries < len(s.channels); tries++ {
+		if s.tuneToLocked((i+tries)%len(s.channels), now) {
+			return
+		}
+	}
+
+	r := currentReceiver()
+	half := r.SampleRate / 2
+	warnf("Scan: no channel lies within the profile (%s to %s)", formatMHz(r.CenterFreq-half), formatMHz(r.CenterFreq+half))
+	s.tunedAt = now
+}
+
+// tuneToLocked moves to channel i, setting its mode and squelch level
+// along with the frequency, and returns false if it lies outside the
+// profile.
+func (s *scanner) tuneToLocked(i int, now time.Time) bool {
+	r := currentReceiver()
+	half := r.SampleRate / 2
+	channel := s.channels[i]
+	offset := channel.Frequency - r.CenterFreq
+	if r.SampleRate != 0 && (offset < -half || offset > half) {
+		return false
+	}
+
+	s.index = i
+	s.tunedAt = now
+	updateDSP(func(d *owrx.DSP) {
+		d.OffsetFreq = int(offset)
+		s.applyChannel(d, channel)
+	})
+	return true
+}
+
+// applyChannel switches d to the channel's mode and squelch level, or back
+// to the ones the scan started with.
+func (s *scanner) applyChannel(d *owrx.DSP, channel scanChannel) {
+	mode := channel.Mode
+	if mode == "" {
+		mode = s.baseMode
+	}
+	if m, ok := owrx.FindMode(mode); ok && d.Mod != mode {
+		d.SetMode(m)
+	}
+
+	d.SquelchLevel = s.baseSquelch
+	if channel.Squelch != nil {
+		d.SquelchLevel = *channel.Squelch
+	}
+}
+
+// recordHitLocked counts a hold on channel i that began at openedAt.
+func (s *scanner) recordHitLocked(i int, openedAt time.Time, peak float64, now time.Time) {
+	hit := s.hits[i]
+	if hit == nil {
+		hit = &scanHit{Peak: math.Inf(-1)}
+		s.hits[i] = hit
+	}
+	hit.Count++
+	hit.Total += now.Sub(openedAt)
+	hit.Peak = math.Max(hit.Peak, peak)
+
+	infof("Scan: %s clear after %v", s.channels[i], now.Sub(openedAt).Round(100*time.Millisecond))
+}
+
+// closeScanner logs the channels on which signals were found.
+func closeScanner() {
+	if scan == nil {
+		return
+	}
+
+	scan.mu.Lock()
+	defer scan.mu.Unlock()
+
+	now := time.Now()
+	if scan.checking && scan.saved.open {
+		scan.recordHitLocked(scan.resume, scan.savedAt, scan.savedPeak, now)
+	}
+	if !scan.checking && scan.squelch.open {
+		scan.recordHitLocked(scan.index, scan.openedAt, scan.peak, now)
+	}
+
+	infof("Scan summary: activity on %d of %d channels", len(scan.hits), len(scan.channels))
+	for i, channel := range scan.channels {
+		if hit := scan.hits[i]; hit != nil {
+			infof("  %s: %d hits, %v total, peak %.1f dB", channel, hit.Count, hit.Total.Round(100*time.Millisecond), hit.Peak)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import "time"
+
+// minPriorityInterval keeps -priority checks from taking up most of the
+// scan.
+const minPriorityInterval = 4 * (scanSettle + priorityLook)
+
+// setPriority makes the channel at frequency the priority channel: the
+// -scan-list entry for it, with its mode and squelch level, or else a
+// channel of its own added to the scan.
+func (s *scanner) setPriority(frequency int64) {
+	for i, channel := range s.channels {
+		if channel.Frequency == frequency {
+			s.priority = i
+			break
+		}
+	}
+	if s.priority < 0 {
+		s.channels = append(s.channels, scanChannel{Frequency: frequency})
+		s.priority = len(s.channels) - 1
+	}
+	infof("Priority channel %s, checked every %v", s.channels[s.priority], *priorityEvery)
+}
+
+// startPriorityCheckLocked leaves the current channel, and the hold on it
+// if there is one, to listen on the priority channel for a moment.
+func (s *scanner) startPriorityCheckLocked(now time.Time) {
+	s.priorityAt = now
+	resume := s.index
+	if !s.tuneToLocked(s.priority, now) {
+		if !s.farWarned {
+			s.farWarned = true
+			warnf("Scan: priority channel %s lies outside the profile", s.channels[s.priority])
+		}
+		return
+	}
+	s.farWarned = false
+
+	s.checking = true
+	s.resume = resume
+	s.saved, s.savedAt, s.savedPeak = s.squelch, s.openedAt, s.peak
+	s.squelch = squelchDetector{hang: s.squelch.hang}
+}
+
+// checkPriorityLocked holds on the priority channel if it has a signal,
+// ending the interrupted hold, and otherwise goes back where the scan was
+// once priorityLook has passed.
+func (s *scanner) checkPriorityLocked(db float64, now time.Time) {
+	s.squelch.level = float64(currentDSP().SquelchLevel)
+	if opened, _ := s.squelch.update(db, now); opened {
+		s.checking = false
+		s.resuming = true
+		if s.saved.open {
+			s.recordHitLocked(s.resume, s.savedAt, s.savedPeak, now)
+		}
+		s.openedAt = now
+		s.peak = db
+		infof("Scan: priority signal on %s at %.1f dB", s.channels[s.index], db)
+		return
+	}
+	if now.Sub(s.tunedAt) < scanSettle+priorityLook {
+		return
+	}
+
+	s.checking = false
+	s.squelch = s.saved
+	s.openedAt, s.peak = s.savedAt, s.savedPeak
+	s.tuneLocked(s.resume, now)
+}
@@ -0,0 +1,51 @@
+package main
+
+import "strings"
+
+// sdrErrorActions are the choices for -sdr-error.
+var sdrErrorActions = []string{"log", "reconnect", "next-profile"}
+
+func validateSDRErrorAction() {
+	for _, action := range sdrErrorActions {
+		if *sdrErrorAction == action {
+			// Without -reconnect, closing the connection would just end
+			// the session without an error.
+			if action == "reconnect" && !*reconnect {
+				fatalf("-sdr-error reconnect needs -reconnect")
+			}
+			return
+		}
+	}
+	fatalf("Unknown -sdr-error %q, use one of: %s", *sdrErrorAction, strings.Join(sdrErrorActions, ", "))
+}
+
+// handleSDRError reports that the device behind the profile failed, e.g.
+// because it is in use or was unplugged, which otherwise just looks like
+// silence.
+func handleSDRError(text string) {
+	errorf("SDR device failed: %s", text)
+
+	switch *sdrErrorAction {
+	case "reconnect":
+		infof("Reconnecting after the device error")
+		// Close waits for the reader this runs on, so it can't be called
+		// directly.
+		go func() {
+			if err := client.Close(); err != nil {
+				errorf("closing connection: %v", err)
+			}
+		}()
+	case "next-profile":
+		if len(currentProfiles()) < 2 {
+			warnf("no other profile to switch to")
+			return
+		}
+		switchProfile(1)
+	}
+}
+
+// handleDemodulatorError reports that the server couldn't start the
+// demodulator, e.g. because a decoder is missing.
+func handleDemodulatorError(text string) {
+	errorf("demodulator failed: %s", text)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// secondaryModes lists the digital modes the secondary demodulator decodes
+// and the primary modes each one can run on.
+var secondaryModes = map[string][]string{
+	"ft8":       {"usb"},
+	"ft4":       {"usb"},
+	"wspr":      {"usb"},
+	"jt65":      {"usb"},
+	"jt9":       {"usb"},
+	"fst4":      {"usb"},
+	"fst4w":     {"usb"},
+	"q65":       {"usb"},
+	"msk144":    {"usb"},
+	"js8":       {"usb"},
+	"bpsk31":    {"usb"},
+	"bpsk63":    {"usb"},
+	"rtty170":   {"usb", "lsb"},
+	"rtty450":   {"usb", "lsb"},
+	"rtty85":    {"usb", "lsb"},
+	"cwdecoder": {"usb", "lsb", "cw"},
+	"packet":    {"nfm"},
+	"pocsag":    {"nfm"},
+}
+
+// secondaryDataTypes are the text messages carrying secondary decoder
+// output that is logged as is.
+var secondaryDataTypes = map[string]bool{
+	"js8_message": true,
+}
+
+func secondaryModeNames() []string {
+	names := make([]string, 0, len(secondaryModes))
+	for name := range secondaryModes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateSecondary checks -secondary against the primary mode. Without an
+// explicit -mod the primary switches to the first one the decoder supports.
+func validateSecondary() {
+	if *secondary == "" {
+		return
+	}
+
+	underlying, ok := secondaryModes[*secondary]
+	if !ok {
+		fatalf("Unknown -secondary %q, known modes: %s", *secondary, strings.Join(secondaryModeNames(), ", "))
+	}
+
+	for _, m := range underlying {
+		if m == *mod {
+			return
+		}
+	}
+	if explicitFlags()["mod"] {
+		fatalf("-secondary %s needs -mod %s", *secondary, strings.Join(underlying, " or "))
+	}
+	*mod = underlying[0]
+}
+
+// secondaryConfig describes the secondary demodulator's output: its FFT
+// spans the IF from 0 Hz to half of SampleRate in FFTSize bins, and the
+// decoder listens to Bandwidth Hz of it.
+type secondaryConfig struct {
+	Mode       string
+	FFTSize    int
+	SampleRate int
+	Bandwidth  int
+}
+
+// secondarySpectrumInterval is how often the secondary FFT's strongest
+// signal is logged.
+const secondarySpectrumInterval = 10 * time.Second
+
+var (
+	secondaryMu    sync.Mutex
+	secondaryState secondaryConfig
+	// secondaryLogged is when the secondary FFT was last logged.
+	secondaryLogged time.Time
+)
+
+func currentSecondaryConfig() secondaryConfig {
+	secondaryMu.Lock()
+	defer secondaryMu.Unlock()
+
+	return secondaryState
+}
+
+func handleSecondaryConfig(config owrx.SecondaryConfig) {
+	c := secondaryConfig{
+		Mode:       currentDSP().SecondaryMod,
+		FFTSize:    config.FFTSize,
+		SampleRate: config.IFSampleRate,
+		Bandwidth:  int(config.Bandwidth),
+	}
+
+	secondaryMu.Lock()
+	secondaryState = c
+	secondaryMu.Unlock()
+
+	if c.Mode == "" {
+		return
+	}
+	infof("Secondary demodulator %s running: %d Hz wide, IF at %d Hz, %d FFT bins", c.Mode, c.Bandwidth, c.SampleRate, c.FFTSize)
+}
+
+// handleSecondaryFFT logs the strongest signal in the secondary
+// demodulator's FFT and how far it stands above the noise at debug level,
+// every secondarySpectrumInterval, to help put a decoder on a signal.
+func handleSecondaryFFT(bins []float32) {
+	now := time.Now()
+	secondaryMu.Lock()
+	c := secondaryState
+	due := now.Sub(secondaryLogged) >= secondarySpectrumInterval
+	if due {
+		secondaryLogged = now
+	}
+	secondaryMu.Unlock()
+	if !due || len(bins) == 0 || c.SampleRate == 0 {
+		return
+	}
+
+	peak := 0
+	for i, v := range bins {
+		if v > bins[peak] {
+			peak = i
+		}
+	}
+	hz := float64(peak) * float64(c.SampleRate) / 2 / float64(len(bins))
+	debugf("Secondary FFT: strongest signal at %.0f Hz, %.1f dB, %.1f dB above the noise", hz, bins[peak], bins[peak]-median(bins))
+}
+
+// handleSecondaryText logs the free text decoded by modes such as PSK31,
+// RTTY or CW as it arrives.
+func handleSecondaryText(text string) {
+	text = strings.TrimRight(text, "\r\n")
+	if text != "" {
+		infof("Secondary: %s", text)
+	}
+}
+
+func handleSecondaryData(msgType string, data json.RawMessage) {
+	infof("Secondary %s: %s", strings.TrimSuffix(strings.TrimSuffix(msgType, "_message"), "_data"), data)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recordingInfo is the content of a -sidecar file: what was recorded, from
+// where, and what happened meanwhile.
+type recordingInfo struct {
+	File       string           `json:"file"`
+	Server     *serverInfo      `json:"server,omitempty"`
+	Receiver   string           `json:"receiver,omitempty"`
+	Location   string           `json:"location,omitempty"`
+	Profile    string           `json:"profile,omitempty"`
+	Frequency  int64            `json:"frequency,omitempty"`
+	Mode       string           `json:"mode"`
+	Start      time.Time        `json:"start"`
+	Stop       *time.Time       `json:"stop,omitempty"`
+	Duration   float64          `json:"duration_seconds"`
+	SampleRate int              `json:"sample_rate,omitempty"`
+	PeakSmeter *float64         `json:"peak_smeter_db,omitempty"`
+	Squelch    []sidecarSquelch `json:"squelch_events"`
+	Events     []sidecarEvent   `json:"metadata"`
+}
+
+// sidecarSquelch is a squelch opening or closing during a recording; an
+// opening may predate the recording, which VOX starts on it.
+type sidecarSquelch struct {
+	Time     time.Time `json:"time"`
+	Open     bool      `json:"open"`
+	Level    float64   `json:"level_db"`
+	Duration float64   `json:"duration_seconds,omitempty"`
+}
+
+// sidecarEvent is something decoded during a recording, as in the -json
+// dump.
+type sidecarEvent struct {
+	Time  time.Time   `json:"time"`
+	Event string      `json:"event"`
+	Value interface{} `json:"value"`
+}
+
+// recordingSidecar keeps the -sidecar file of one recording up to date.
+// It is written when the recording starts and again when it ends.
+type recordingSidecar struct {
+	path string
+
+	mu   sync.Mutex
+	info recordingInfo
+}
+
+var (
+	sidecarsMu sync.Mutex
+	sidecars   = map[*recordingSidecar]bool{}
+	// squelchOpen is the opening of the squelch while it is open, for the
+	// recordings started during it.
+	squelchOpen *squelchEvent
+)
+
+// setupSidecars starts following the squelch and smeter for -sidecar. It
+// must come before the VOX recorder registers, so a closing reaches the
+// sidecar before VOX ends the recording.
+func setupSidecars() {
+	if !*sidecar {
+		return
+	}
+	addSquelchHandler(handleSidecarSquelch)
+	addSmeterHandler(handleSidecarSmeter)
+}
+
+// sidecarPath is the recording's name with a .json extension.
+func sidecarPath(recording string) string {
+	return strings.TrimSuffix(recording, filepath.Ext(recording)) + ".json"
+}
+
+// newSidecar describes a recording to name starting now and writes its
+// sidecar file. It returns nil without -sidecar.
+func newSidecar(name string) *recordingSidecar {
+	if !*sidecar {
+		return nil
+	}
+
+	info := recordingInfo{
+		File:    filepath.Base(name),
+		Start:   time.Now(),
+		Squelch: []sidecarSquelch{},
+		Events:  []sidecarEvent{},
+	}
+	describeReceiver(&info)
+
+	sc := &recordingSidecar{path: sidecarPath(name), info: info}
+
+	sidecarsMu.Lock()
+	if squelchOpen != nil {
+		sc.info.Squelch = append(sc.info.Squelch, sidecarSquelchEvent(*squelchOpen))
+	}
+	sidecars[sc] = true
+	sidecarsMu.Unlock()
+
+	sc.write()
+	return sc
+}
+
+// finish records the end of the recording and writes the file a last
+// time.
+func (sc *recordingSidecar) finish(duration time.Duration, rate int) {
+	if sc == nil {
+		return
+	}
+
+	sidecarsMu.Lock()
+	delete(sidecars, sc)
+	sidecarsMu.Unlock()
+
+	sc.mu.Lock()
+	stop := time.Now()
+	sc.info.Stop = &stop
+	sc.info.Duration = math.Round(duration.Seconds()*1000) / 1000
+	sc.info.SampleRate = rate
+	describeReceiver(&sc.info)
+	sc.mu.Unlock()
+
+	sc.write()
+}
+
+// describeReceiver fills in what info doesn't have yet about the receiver
+// and tuning. A recording may start before the server has said much, as
+// one given with -o does, so this is done again when it ends.
+func describeReceiver(info *recordingInfo) {
+	if info.Server == nil {
+		info.Server = currentServer()
+	}
+	if d := currentDetails(); d != nil && info.Receiver == "" {
+		info.Receiver, info.Location = d.Name, d.Location
+	}
+	r := currentReceiver()
+	s := currentDSP()
+	if info.Profile == "" {
+		info.Profile = r.ProfileID
+	}
+	if info.Mode == "" {
+		info.Mode = s.Mod
+	}
+	if info.Frequency == 0 && r.CenterFreq > 0 {
+		info.Frequency = r.CenterFreq + int64(s.OffsetFreq)
+	}
+}
+
+func (sc *recordingSidecar) write() {
+	sc.mu.Lock()
+	data, err := json.MarshalIndent(sc.info, "", "  ")
+	sc.mu.Unlock()
+	if err != nil {
+		errorf("encoding %s: %v", sc.path, err)
+		return
+	}
+	if err := os.WriteFile(sc.path, append(data, '\n'), 0o644); err != nil {
+		errorf("writing %s: %v", sc.path, err)
+	}
+}
+
+// eachSidecar calls f for every recording in progress.
+func eachSidecar(f func(sc *recordingSidecar)) {
+	sidecarsMu.Lock()
+	defer sidecarsMu.Unlock()
+
+	for sc := range sidecars {
+		sc.mu.Lock()
+		f(sc)
+		sc.mu.Unlock()
+	}
+}
+
+func sidecarSquelchEvent(e squelchEvent) sidecarSquelch {
+	return sidecarSquelch{
+		Time:     e.Time,
+		Open:     e.Open,
+		Level:    e.Level,
+		Duration: e.Duration.Seconds(),
+	}
+}
+
+func handleSidecarSquelch(e squelchEvent) {
+	sidecarsMu.Lock()
+	if e.Open {
+		squelchOpen = &e
+	} else {
+		squelchOpen = nil
+	}
+	sidecarsMu.Unlock()
+
+	eachSidecar(func(sc *recordingSidecar) {
+		sc.info.Squelch = append(sc.info.Squelch, sidecarSquelchEvent(e))
+	})
+}
+
+func handleSidecarSmeter(r smeterReading) {
+	db := smeterDB(r.Value)
+	if math.IsInf(db, -1) {
+		return
+	}
+	eachSidecar(func(sc *recordingSidecar) {
+		if sc.info.PeakSmeter == nil || db > *sc.info.PeakSmeter {
+			peak := db
+			sc.info.PeakSmeter = &peak
+		}
+	})
+}
+
+// recordDecoded adds something decoded, such as a DMR call or an APRS
+// frame, to the recordings in progress.
+func recordDecoded(event string, value interface{}) {
+	now := time.Now()
+	eachSidecar(func(sc *recordingSidecar) {
+		sc.info.Events = append(sc.info.Events, sidecarEvent{Time: now, Event: event, Value: value})
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	smeterMu       sync.Mutex
+	smeterHandlers []func(r smeterReading)
+	smeterClosers  []io.Closer
+	smeterAverage  movingAverage
+
+	// smeterCalibrated is whether -smeter-cal was given, without which
+	// there is no dBm to report.
+	smeterCalibrated bool
+)
+
+// smeterReading is a smeter value as sent by the server, a linear power,
+// along with its moving average over -smeter-window, which equals the value
+// when averaging is off.
+type smeterReading struct {
+	Time    time.Time
+	Value   float64
+	Average float64
+}
+
+func validateSmeterCal() {
+	smeterCalibrated = explicitFlags()["smeter-cal"]
+}
+
+// smeterDBm is a level in dB calibrated to dBm at the antenna input with
+// -smeter-cal.
+func smeterDBm(db float64) float64 {
+	return db + *smeterCal
+}
+
+// formatLevel shows a level in dB, and in dBm as well once calibrated.
+func formatLevel(db float64) string {
+	if smeterCalibrated {
+		return fmt.Sprintf("%.1f dB, %.1f dBm", db, smeterDBm(db))
+	}
+	return fmt.Sprintf("%.1f dB", db)
+}
+
+func setupSmeterOutputs() {
+	if *smeterCSV != "" {
+		w, err := openSmeterCSV(*smeterCSV)
+		if err != nil {
+			fatalf("Failed to open %s: %v", *smeterCSV, err)
+		}
+		addSmeterHandler(func(r smeterReading) {
+			w.write(smeterCSVRow(r))
+		})
+		smeterClosers = append(smeterClosers, w)
+	}
+}
+
+func closeSmeterOutputs() {
+	smeterMu.Lock()
+	smeterHandlers = nil
+	closers := smeterClosers
+	smeterClosers = nil
+	smeterMu.Unlock()
+
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			errorf("closing smeter output: %v", err)
+		}
+	}
+}
+
+func addSmeterHandler(handler func(r smeterReading)) {
+	smeterMu.Lock()
+	defer smeterMu.Unlock()
+
+	smeterHandlers = append(smeterHandlers, handler)
+}
+
+func handleSmeter(value float64) {
+	r := smeterReading{Time: time.Now(), Value: value, Average: value}
+	if *smeterWindow > 0 {
+		r.Average = smeterAverage.add(r.Time, value, *smeterWindow)
+	}
+
+	if *smeterWindow > 0 {
+		debugf("Smeter: %v (%s), average %v (%s)", r.Value, formatLevel(smeterDB(r.Value)), r.Average, formatLevel(smeterDB(r.Average)))
+	} else {
+		debugf("Smeter: %v (%s)", r.Value, formatLevel(smeterDB(r.Value)))
+	}
+
+	smeterMu.Lock()
+	defer smeterMu.Unlock()
+
+	for _, handler := range smeterHandlers {
+		handler(r)
+	}
+}
+
+// movingAverage averages the values added over a sliding time window.
+type movingAverage struct {
+	times  []time.Time
+	values []float64
+}
+
+func (m *movingAverage) add(now time.Time, value float64, window time.Duration) float64 {
+	m.times = append(m.times, now)
+	m.values = append(m.values, value)
+
+	drop := 0
+	for drop < len(m.times)-1 && now.Sub(m.times[drop]) > window {
+		drop++
+	}
+	m.times = m.times[drop:]
+	m.values = m.values[drop:]
+
+	sum := 0.0
+	for _, v := range m.values {
+		sum += v
+	}
+	return sum / float64(len(m.values))
+}
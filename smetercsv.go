@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// openSmeterCSV opens path for -smeter-csv, appending a row per smeter
+// reading.
+func openSmeterCSV(path string) (*eventCSVWriter, error) {
+	return openEventCSV("smeter", path, []string{"timestamp", "value", "average"})
+}
+
+func smeterCSVRow(r smeterReading) []string {
+	return []string{
+		r.Time.Format(time.RFC3339Nano),
+		strconv.FormatFloat(r.Value, 'g', -1, 64),
+		strconv.FormatFloat(r.Average, 'g', -1, 64),
+	}
+}
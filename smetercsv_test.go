@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSmeterCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "smeter.csv")
+	at := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	// The second session appends without another header.
+	for i := 0; i < 2; i++ {
+		w, err := openSmeterCSV(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.write(smeterCSVRow(smeterReading{Time: at, Value: 0.001, Average: 0.0005}))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "timestamp,value,average\n" +
+		"2026-10-14T09:00:00Z,0.001,0.0005\n" +
+		"2026-10-14T09:00:00Z,0.001,0.0005\n"
+	if string(data) != want {
+		t.Errorf("smeter CSV:\n%s\nwant:\n%s", data, want)
+	}
+}
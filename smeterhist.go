@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/csv"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// smeterHistRows is the most rows the histogram is logged in; wider
+	// ranges put several dB in a row.
+	smeterHistRows = 30
+	smeterHistBar  = 40
+
+	// noiseFloorPercentile is taken for the noise floor: a channel is
+	// quiet most of the time, so most readings are noise, yet the floor
+	// holds while it is busy for up to four fifths of the session.
+	noiseFloorPercentile = 20
+)
+
+// smeterHistogram counts the smeter readings of the session by whole dB,
+// for -smeter-histogram.
+type smeterHistogram struct {
+	mu     sync.Mutex
+	counts map[int]uint64
+	total  uint64
+}
+
+var smeterHist *smeterHistogram
+
+func setupSmeterHistogram() {
+	if !*smeterHistLog && *smeterHistCSV == "" {
+		return
+	}
+	smeterHist = &smeterHistogram{counts: make(map[int]uint64)}
+	addSmeterHandler(smeterHist.handleSmeter)
+}
+
+// handleSmeter counts the averaged level, the one the squelch goes by.
+func (h *smeterHistogram) handleSmeter(r smeterReading) {
+	db := smeterDB(r.Average)
+	if math.IsInf(db, -1) {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.counts[int(math.Floor(db))]++
+	h.total++
+}
+
+// levels returns the dB levels seen, lowest first.
+func (h *smeterHistogram) levels() []int {
+	levels := make([]int, 0, len(h.counts))
+	for db := range h.counts {
+		levels = append(levels, db)
+	}
+	sort.Ints(levels)
+	return levels
+}
+
+// percentile is the level p percent of the readings are at or below.
+func (h *smeterHistogram) percentile(p float64) int {
+	levels := h.levels()
+	want := uint64(math.Ceil(float64(h.total) * p / 100))
+	var seen uint64
+	for _, db := range levels {
+		seen += h.counts[db]
+		if seen >= want {
+			return db
+		}
+	}
+	return levels[len(levels)-1]
+}
+
+// closeSmeterHistogram logs the histogram and the noise floor estimate and
+// writes -smeter-histogram-csv.
+func closeSmeterHistogram() {
+	h := smeterHist
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.total == 0 {
+		infof("Smeter histogram: no readings")
+		return
+	}
+	if *smeterHistLog {
+		h.logLocked()
+	}
+	if *smeterHistCSV != "" {
+		if err := h.writeCSVLocked(*smeterHistCSV); err != nil {
+			errorf("writing %s: %v", *smeterHistCSV, err)
+		}
+	}
+}
+
+func (h *smeterHistogram) logLocked() {
+	levels := h.levels()
+	low, high := levels[0], levels[len(levels)-1]
+	width := (high - low + smeterHistRows) / smeterHistRows
+
+	var rows []uint64
+	var most uint64
+	for db := low; db <= high; db += width {
+		var n uint64
+		for i := db; i < db+width; i++ {
+			n += h.counts[i]
+		}
+		rows = append(rows, n)
+		if n > most {
+			most = n
+		}
+	}
+
+	infof("Smeter histogram of %d readings, %d dB per row:", h.total, width)
+	for i, n := range rows {
+		bar := strings.Repeat("#", int(math.Round(float64(n)/float64(most)*smeterHistBar)))
+		infof("  %5d dB %-*s %5.1f%%", low+i*width, smeterHistBar, bar, float64(n)/float64(h.total)*100)
+	}
+	floor := h.percentile(noiseFloorPercentile)
+	infof("Noise floor about %d dB (%dth percentile); 50%% of readings are at or below %d dB, 90%% at or below %d dB, 99%% at or below %d dB",
+		floor, noiseFloorPercentile, h.percentile(50), h.percentile(90), h.percentile(99))
+}
+
+// writeCSVLocked writes a row per dB level: the level, the readings at it
+// and the share of all readings at or below it.
+func (h *smeterHistogram) writeCSVLocked(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(file)
+	w.Write([]string{"level_db", "count", "cumulative_percent"})
+
+	var seen uint64
+	for _, db := range h.levels() {
+		seen += h.counts[db]
+		w.Write([]string{
+			strconv.Itoa(db),
+			strconv.FormatUint(h.counts[db], 10),
+			strconv.FormatFloat(float64(seen)/float64(h.total)*100, 'f', 2, 64),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
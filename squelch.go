@@ -0,0 +1,137 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// smeterDB converts the server's linear smeter reading to dB, the scale
+// squelch_level is given in.
+func smeterDB(value float64) float64 {
+	if value <= 0 {
+		return math.Inf(-1)
+	}
+	return 10 * math.Log10(value)
+}
+
+// squelchDetector tracks the squelch state from smeter readings. It opens
+// as soon as the level exceeds the threshold and closes once the level has
+// stayed below it for the hang time.
+type squelchDetector struct {
+	level     float64
+	hang      time.Duration
+	open      bool
+	lastAbove time.Time
+}
+
+func (d *squelchDetector) update(db float64, now time.Time) (opened, closed bool) {
+	if db > d.level {
+		d.lastAbove = now
+		if !d.open {
+			d.open = true
+			return true, false
+		}
+		return false, false
+	}
+
+	if d.open && now.Sub(d.lastAbove) >= d.hang {
+		d.open = false
+		return false, true
+	}
+	return false, false
+}
+
+// squelchEvent is the squelch opening or closing. A closing carries how
+// long the squelch was open.
+type squelchEvent struct {
+	Time     time.Time
+	Open     bool
+	Level    float64
+	Duration time.Duration
+}
+
+// squelchTracker turns the smeter stream into squelch events against the
+// current squelch_level, and counts them for the summary on exit.
+type squelchTracker struct {
+	mu       sync.Mutex
+	detector squelchDetector
+	openedAt time.Time
+	openings int
+	active   time.Duration
+	handlers []func(e squelchEvent)
+}
+
+var squelchEvents *squelchTracker
+
+// addSquelchHandler registers handler for squelch events, starting the
+// tracking on first use.
+func addSquelchHandler(handler func(e squelchEvent)) {
+	if squelchEvents == nil {
+		squelchEvents = &squelchTracker{
+			detector: squelchDetector{hang: *squelchHang},
+		}
+		addSmeterHandler(squelchEvents.handleSmeter)
+	}
+
+	squelchEvents.mu.Lock()
+	defer squelchEvents.mu.Unlock()
+
+	squelchEvents.handlers = append(squelchEvents.handlers, handler)
+}
+
+func setupSquelchEvents() {
+	if *squelchLog {
+		addSquelchHandler(func(squelchEvent) {})
+	}
+}
+
+func (t *squelchTracker) handleSmeter(r smeterReading) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	db := smeterDB(r.Average)
+	// The squelch may be changed at runtime from the interactive console.
+	t.detector.level = float64(currentDSP().SquelchLevel)
+	opened, closed := t.detector.update(db, r.Time)
+	switch {
+	case opened:
+		t.openedAt = r.Time
+		t.openings++
+		t.emitLocked(squelchEvent{Time: r.Time, Open: true, Level: db})
+	case closed:
+		d := r.Time.Sub(t.openedAt)
+		t.active += d
+		t.emitLocked(squelchEvent{Time: r.Time, Level: db, Duration: d})
+	}
+}
+
+func (t *squelchTracker) emitLocked(e squelchEvent) {
+	if e.Open {
+		infof("Squelch open at %.1f dB", e.Level)
+	} else {
+		infof("Squelch closed after %v", e.Duration.Round(100*time.Millisecond))
+	}
+
+	for _, handler := range t.handlers {
+		handler(e)
+	}
+}
+
+// closeSquelchEvents counts a squelch still open in the summary and logs
+// it. No closing event is sent for it.
+func closeSquelchEvents() {
+	t := squelchEvents
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	active := t.active
+	if t.detector.open {
+		active += time.Since(t.openedAt)
+	}
+	infof("Squelch summary: %d openings, open for %v in total", t.openings, active.Round(100*time.Millisecond))
+}
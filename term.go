@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+const defaultTerminalWidth = 80
+
+// terminalWidth returns the width of the terminal on f, falling back to
+// $COLUMNS and then 80 columns when it isn't a terminal.
+func terminalWidth(f *os.File) int {
+	if width, _, ok := terminalSize(f.Fd()); ok {
+		return width
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return defaultTerminalWidth
+}
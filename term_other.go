@@ -0,0 +1,22 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import "errors"
+
+// terminalSupported is false here: there is no raw mode for -interactive
+// and -tui.
+const terminalSupported = false
+
+func terminalSize(fd uintptr) (width, height int, ok bool) {
+	return 0, 0, false
+}
+
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (restore func(), err error) {
+	return nil, errors.New("not supported on this platform")
+}
@@ -0,0 +1,28 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNotATerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if isTerminal(r.Fd()) {
+		t.Error("isTerminal reports a pipe as a terminal")
+	}
+	if _, _, ok := terminalSize(r.Fd()); ok {
+		t.Error("terminalSize has a size for a pipe")
+	}
+	if _, err := makeRaw(r.Fd()); err == nil {
+		t.Error("makeRaw succeeded on a pipe")
+	}
+}
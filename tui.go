@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+const (
+	dashboardInterval  = 100 * time.Millisecond
+	dashboardLogLines  = 200
+	dashboardMinHeight = 16
+	defaultTermHeight  = 24
+
+	// The smeter bar spans this range in dB.
+	smeterBarMin = -130
+	smeterBarMax = -10
+
+	dashboardHelp = "←/→ tune  ↑/↓ step  m/M mode  p/P profile  [/] squelch  a AGC  n NR  u mute  Ctrl-C quit"
+)
+
+// dashboard is the -tui screen: the tuning and connection state, a smeter
+// bar and a compact waterfall above the latest log lines, which carry the
+// decoded metadata and messages. It takes over stderr on the terminal's
+// alternate screen and redraws at most every dashboardInterval. Keys go to
+// the interactive console it belongs to.
+type dashboard struct {
+	file    *os.File
+	out     *bufio.Writer
+	console *console
+
+	mu        sync.Mutex
+	lines     []string
+	partial   []byte
+	smeter    float64
+	seen      bool
+	state     string
+	waterfall [][]float32
+	scale     waterfallScale
+	dirty     bool
+
+	redraw chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newDashboard(file *os.File, c *console) *dashboard {
+	d := &dashboard{
+		file:    file,
+		out:     bufio.NewWriter(file),
+		console: c,
+		state:   "starting",
+		dirty:   true,
+		redraw:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	addSmeterHandler(d.handleSmeter)
+	addFFTHandler(d.handleFFT)
+	client.OnStatus(d.handleStatus)
+
+	// Switch to the alternate screen and hide the cursor.
+	io.WriteString(d.out, "\x1b[?1049h\x1b[?25l")
+	d.out.Flush()
+
+	d.wg.Add(1)
+	go d.run()
+	return d
+}
+
+// Write takes log output, keeping the latest lines for the screen.
+func (d *dashboard) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.partial = append(d.partial, p...)
+	for {
+		i := bytes.IndexByte(d.partial, '\n')
+		if i < 0 {
+			break
+		}
+		d.lines = append(d.lines, string(d.partial[:i]))
+		d.partial = d.partial[i+1:]
+	}
+	if n := len(d.lines); n > dashboardLogLines {
+		d.lines = append([]string(nil), d.lines[n-dashboardLogLines:]...)
+	}
+	d.dirty = true
+	return len(p), nil
+}
+
+func (d *dashboard) handleSmeter(r smeterReading) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.smeter = smeterDB(r.Average)
+	d.seen = true
+	d.dirty = true
+}
+
+func (d *dashboard) handleFFT(frame FFTFrame) {
+	width, _ := d.size()
+	row := decimateBins(frame.Bins, width)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.scale.update(frame.Bins)
+	d.waterfall = append([][]float32{row}, d.waterfall...)
+	if rows := d.waterfallRows(); len(d.waterfall) > rows {
+		d.waterfall = d.waterfall[:rows]
+	}
+	d.dirty = true
+}
+
+func (d *dashboard) handleStatus(status owrx.Status) {
+	var state string
+	switch status.State {
+	case owrx.StateConnecting:
+		state = "connecting to " + client.URL()
+	case owrx.StateConnected:
+		state = "connected to " + client.URL()
+	case owrx.StateConnectFailed:
+		state = fmt.Sprintf("connection failed: %v", status.Err)
+	case owrx.StateDisconnected:
+		state = "disconnected"
+	case owrx.StateWaiting:
+		state = fmt.Sprintf("reconnecting in %v", status.Delay.Round(time.Second))
+	case owrx.StateClosing:
+		state = "closing"
+	default:
+		return
+	}
+
+	d.mu.Lock()
+	d.state = state
+	d.dirty = true
+	d.mu.Unlock()
+}
+
+// refresh asks for a redraw, e.g. after a key press. It doesn't block, so
+// it may be called with the console locked.
+func (d *dashboard) refresh() {
+	select {
+	case d.redraw <- struct{}{}:
+	default:
+	}
+}
+
+func (d *dashboard) run() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(dashboardInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			d.draw(false)
+		case <-d.redraw:
+			d.draw(true)
+		}
+	}
+}
+
+// close leaves the alternate screen and prints the log lines kept, so the
+// session's log isn't lost with it.
+func (d *dashboard) close() {
+	close(d.done)
+	d.wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	io.WriteString(d.out, "\x1b[?25h\x1b[?1049l")
+	for _, line := range d.lines {
+		fmt.Fprintln(d.out, line)
+	}
+	if len(d.partial) > 0 {
+		fmt.Fprintln(d.out, string(d.partial))
+	}
+	d.out.Flush()
+}
+
+func (d *dashboard) size() (width, height int) {
+	width, height, ok := terminalSize(d.file.Fd())
+	if !ok {
+		return terminalWidth(d.file), defaultTermHeight
+	}
+	return width, height
+}
+
+// waterfallRows is how many lines of the screen the waterfall gets, about
+// a third of it.
+func (d *dashboard) waterfallRows() int {
+	_, height := d.size()
+	if height < dashboardMinHeight {
+		height = dashboardMinHeight
+	}
+	return height / 3
+}
+
+func (d *dashboard) draw(force bool) {
+	// The console's own lock is taken first and on its own, as the console
+	// calls refresh with it held.
+	c := d.console
+	c.mu.Lock()
+	step, snap, prompt := c.step, c.snap, c.promptLocked()
+	c.mu.Unlock()
+
+	width, height := d.size()
+	if height < dashboardMinHeight {
+		height = dashboardMinHeight
+	}
+	r := currentReceiver()
+	s := currentDSP()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.dirty && !force {
+		return
+	}
+	d.dirty = false
+
+	var screen []string
+	screen = append(screen, d.header(), tuningStatus(s, step, snap), d.smeterBar(width, s.SquelchLevel))
+
+	// The ruler matches the waterfall, which is narrower than the screen
+	// when the server sends fewer bins.
+	rulerWidth := width
+	if len(d.waterfall) > 0 && len(d.waterfall[0]) < width {
+		rulerWidth = len(d.waterfall[0])
+	}
+	labels, ticks := waterfallRuler(r, rulerWidth)
+	screen = append(screen, string(labels), string(ticks))
+	low, high := d.scale.bounds(r)
+	for i := 0; i < d.waterfallRows(); i++ {
+		if i >= len(d.waterfall) {
+			screen = append(screen, "")
+			continue
+		}
+		var line strings.Builder
+		for _, v := range d.waterfall[i] {
+			fmt.Fprintf(&line, "\x1b[48;5;%dm ", waterfallPalette.ansi(v, low, high))
+		}
+		line.WriteString("\x1b[0m")
+		screen = append(screen, line.String())
+	}
+
+	screen = append(screen, strings.Repeat("─", width))
+	logRows := height - len(screen) - 2
+	lines := d.lines
+	if len(lines) > logRows {
+		lines = lines[len(lines)-logRows:]
+	}
+	for i := 0; i < logRows; i++ {
+		line := ""
+		if i < len(lines) {
+			line = truncate(lines[i], width)
+		}
+		screen = append(screen, line)
+	}
+	screen = append(screen, truncate(dashboardHelp, width), prompt)
+
+	io.WriteString(d.out, "\x1b[H")
+	for i, line := range screen {
+		if i > 0 {
+			io.WriteString(d.out, "\r\n")
+		}
+		if !strings.Contains(line, "\x1b[") {
+			line = truncate(line, width)
+		}
+		io.WriteString(d.out, line+"\x1b[K")
+	}
+	io.WriteString(d.out, "\x1b[J")
+	d.out.Flush()
+}
+
+func (d *dashboard) header() string {
+	header := "owrxp-playground"
+	if s := currentServer(); s != nil {
+		header += fmt.Sprintf(" · %s %s", s.Name, s.Version)
+	}
+	if details := currentDetails(); details != nil && details.Name != "" {
+		header += " · " + details.Name
+	}
+	if p := currentReceiver().ProfileID; p != "" {
+		header += " · " + p
+	}
+	header += " · " + d.state
+	if rtt := latencyStatus(); rtt != "" {
+		header += " · " + rtt
+	}
+	return header
+}
+
+// smeterBar draws the smeter level as a bar, bright when it is above the
+// squelch level, which is marked with a |.
+func (d *dashboard) smeterBar(width, squelch int) string {
+	label := "S      no reading"
+	level := math.Inf(-1)
+	if d.seen {
+		level = d.smeter
+		label = fmt.Sprintf("S %6.1f dB", d.smeter)
+		if smeterCalibrated {
+			label += fmt.Sprintf(" %6.1f dBm", smeterDBm(d.smeter))
+		}
+	}
+
+	size := width - utf8.RuneCountInString(label) - 3
+	if size < 10 {
+		return label
+	}
+	pos := func(db float64) int {
+		return clamp(int((db-smeterBarMin)/(smeterBarMax-smeterBarMin)*float64(size)), 0, size)
+	}
+	filled, mark := 0, pos(float64(squelch))
+	if !math.IsInf(level, -1) {
+		filled = pos(level)
+	}
+
+	color := "\x1b[2m"
+	if float64(squelch) <= minSquelch || level > float64(squelch) {
+		color = "\x1b[32;1m"
+	}
+	cells := make([]rune, size)
+	for i := range cells {
+		switch {
+		case i == mark && squelch > minSquelch:
+			cells[i] = '|'
+		case i < filled:
+			cells[i] = '█'
+		default:
+			cells[i] = '·'
+		}
+	}
+	return fmt.Sprintf("%s [%s%s\x1b[0m%s]", label, color, string(cells[:filled]), string(cells[filled:]))
+}
+
+// truncate cuts s to width runes.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:width])
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sync"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// serverInfo is the server software, as given in its handshake line.
+type serverInfo struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+var (
+	serverMu sync.Mutex
+	server   *serverInfo
+)
+
+func currentServer() *serverInfo {
+	serverMu.Lock()
+	defer serverMu.Unlock()
+
+	return server
+}
+
+// handleHandshake logs the server's version and warns when the protocol
+// may not be the one the client speaks, which otherwise shows up as
+// confusingly misread messages.
+func handleHandshake(m *owrx.HandshakeMessage) {
+	s := &serverInfo{Name: m.Server, Version: m.Version}
+	serverMu.Lock()
+	server = s
+	serverMu.Unlock()
+
+	name := s.Name
+	if name == "" {
+		name = "unknown"
+	}
+	version := s.Version
+	if version == "" {
+		version = "of unknown version"
+	}
+	infof("Server: %s %s", name, version)
+
+	if err := owrx.CheckServerVersion(m.Version); err != nil {
+		warnf("%v, messages may be misread", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sync"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// voxRecorder records audio only while the squelch is open, starting a new
+// timestamped WAV file for every opening.
+type voxRecorder struct {
+	base string
+
+	mu  sync.Mutex
+	rec *recording
+}
+
+func newVoxRecorder(base string) *voxRecorder {
+	return &voxRecorder{base: base}
+}
+
+func (v *voxRecorder) handleSquelch(e squelchEvent) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if e.Open {
+		rec, err := openRecording(v.base, true)
+		if err != nil {
+			errorf("starting recording: %v", err)
+			return
+		}
+		v.rec = rec
+	} else {
+		infof("Recording stopped")
+		v.closeFile()
+	}
+}
+
+func (v *voxRecorder) closeFile() {
+	if v.rec == nil {
+		return
+	}
+	if err := v.rec.Close(); err != nil {
+		errorf("closing recording: %v", err)
+	}
+	v.rec = nil
+}
+
+func (v *voxRecorder) WriteAudio(frame owrx.AudioFrame) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.rec == nil {
+		return nil
+	}
+	return v.rec.WriteAudio(frame)
+}
+
+func (v *voxRecorder) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.closeFile()
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+)
+
+// waterfallColors are the 256-color palette indices of the classic
+// palette, running from dark blue through green and yellow to red.
+var waterfallColors = []int{
+	16, 17, 18, 19, 20, 21, 27, 33, 39, 45, 51, 50, 49, 48,
+	47, 46, 82, 118, 154, 190, 226, 220, 214, 208, 202, 196,
+}
+
+const (
+	defaultWaterfallMin = -120
+	defaultWaterfallMax = -20
+	waterfallRulerStep  = 16
+)
+
+// terminalWaterfall renders FFT frames as a scrolling ANSI waterfall, one
+// line per frame, with the bins decimated to the terminal width.
+type terminalWaterfall struct {
+	mu       sync.Mutex
+	out      *bufio.Writer
+	file     *os.File
+	width    int
+	receiver receiverState
+	ruler    bool
+	scale    waterfallScale
+}
+
+func newTerminalWaterfall(file *os.File) *terminalWaterfall {
+	return &terminalWaterfall{
+		out:  bufio.NewWriter(file),
+		file: file,
+	}
+}
+
+func (w *terminalWaterfall) handleFFT(frame FFTFrame) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	width := terminalWidth(w.file)
+	if len(frame.Bins) < width {
+		width = len(frame.Bins)
+	}
+	r := currentReceiver()
+	if !w.ruler || width != w.width || r != w.receiver {
+		w.width = width
+		w.receiver = r
+		w.ruler = true
+		w.writeRuler()
+	}
+
+	w.scale.update(frame.Bins)
+	low, high := w.scale.bounds(r)
+	for _, v := range decimateBins(frame.Bins, w.width) {
+		fmt.Fprintf(w.out, "\x1b[48;5;%dm ", waterfallPalette.ansi(v, low, high))
+	}
+	io.WriteString(w.out, "\x1b[0m\n")
+	w.out.Flush()
+}
+
+func (w *terminalWaterfall) writeRuler() {
+	labels, ticks := waterfallRuler(w.receiver, w.width)
+	fmt.Fprintf(w.out, "%s\n%s\n", labels, ticks)
+}
+
+// waterfallRuler returns a line of frequency labels in MHz and a line of
+// ticks under them for a waterfall width columns wide.
+func waterfallRuler(r receiverState, width int) (labels, ticks []byte) {
+	labels = make([]byte, width)
+	ticks = make([]byte, width)
+	for i := range labels {
+		labels[i] = ' '
+		ticks[i] = '-'
+	}
+
+	for col := 0; col < width; col += waterfallRulerStep {
+		ticks[col] = '|'
+		label := fmt.Sprintf("%.3f", float64(r.binFrequency(col, width))/1e6)
+		if col+len(label) <= width {
+			copy(labels[col:], label)
+		}
+	}
+	return labels, ticks
+}
+
+// decimateBins reduces bins to width columns, keeping the strongest bin of
+// each group so narrow signals don't disappear.
+func decimateBins(bins []float32, width int) []float32 {
+	if width <= 0 || len(bins) <= width {
+		return bins
+	}
+
+	out := make([]float32, width)
+	for col := range out {
+		start := col * len(bins) / width
+		end := (col + 1) * len(bins) / width
+		peak := float32(math.Inf(-1))
+		for _, v := range bins[start:end] {
+			if v > peak {
+				peak = v
+			}
+		}
+		out[col] = peak
+	}
+	return out
+}
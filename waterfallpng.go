@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	pngMaxWidth     = 1024
+	pngMaxRows      = 4096
+	pngScale        = 2
+	pngTopMargin    = glyphHeight*pngScale + 6
+	pngLeftMargin   = 8*(glyphWidth+1)*pngScale + 4
+	pngFreqLabelGap = 128
+	pngTimeLabelGap = 64
+)
+
+var (
+	pngBackground = color.RGBA{0, 0, 0, 255}
+	pngLabel      = color.RGBA{255, 255, 255, 255}
+)
+
+// waterfallPNG collects FFT frames into a spectrogram image, written out on
+// Close or once pngMaxRows lines have been collected, after which a new
+// file is started.
+type waterfallPNG struct {
+	template string
+
+	mu       sync.Mutex
+	rows     [][]float32
+	times    []time.Time
+	receiver receiverState
+	segment  int
+}
+
+func newWaterfallPNG(template string) *waterfallPNG {
+	return &waterfallPNG{template: template}
+}
+
+func (w *waterfallPNG) handleFFT(frame FFTFrame) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	r := currentReceiver()
+	if len(w.rows) > 0 && (r != w.receiver || len(decimateBins(frame.Bins, pngMaxWidth)) != len(w.rows[0])) {
+		w.flush()
+	}
+	w.receiver = r
+
+	w.rows = append(w.rows, decimateBins(frame.Bins, pngMaxWidth))
+	w.times = append(w.times, frame.Time)
+
+	if len(w.rows) >= pngMaxRows {
+		w.flush()
+	}
+}
+
+func (w *waterfallPNG) flush() {
+	if len(w.rows) == 0 {
+		return
+	}
+
+	segmented := w.segment > 0 || len(w.rows) >= pngMaxRows
+	name := recordingName(w.template, w.times[0], segmented)
+	if err := writePNG(name, w.render()); err != nil {
+		errorf("writing %s: %v", name, err)
+	} else {
+		infof("Waterfall written to %s", name)
+	}
+
+	w.segment++
+	w.rows = nil
+	w.times = nil
+}
+
+func (w *waterfallPNG) render() *image.RGBA {
+	bins := len(w.rows[0])
+	img := image.NewRGBA(image.Rect(0, 0, pngLeftMargin+bins, pngTopMargin+len(w.rows)))
+	draw.Draw(img, img.Bounds(), &image.Uniform{pngBackground}, image.Point{}, draw.Src)
+
+	scale := scaleOf(w.rows)
+	low, high := scale.bounds(w.receiver)
+	for y, row := range w.rows {
+		for x, v := range row {
+			img.Set(pngLeftMargin+x, pngTopMargin+y, waterfallPalette.color(v, low, high))
+		}
+	}
+
+	for x := 0; x < bins; x += pngFreqLabelGap {
+		label := fmt.Sprintf("%.3f", float64(w.receiver.binFrequency(x, bins))/1e6)
+		drawText(img, pngLeftMargin+x, 1, label, pngScale, pngLabel)
+		for y := pngTopMargin - 4; y < pngTopMargin; y++ {
+			img.Set(pngLeftMargin+x, y, pngLabel)
+		}
+	}
+
+	for y := 0; y < len(w.rows); y += pngTimeLabelGap {
+		label := w.times[y].Format("15:04:05")
+		drawText(img, 1, pngTopMargin+y, label, pngScale, pngLabel)
+	}
+
+	return img
+}
+
+func writePNG(name string, img image.Image) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (w *waterfallPNG) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.flush()
+	return nil
+}
+
+// xtermColor converts a 256-color palette index to RGB.
+func xtermColor(i int) color.RGBA {
+	switch {
+	case i >= 232:
+		v := uint8(8 + (i-232)*10)
+		return color.RGBA{v, v, v, 255}
+	case i >= 16:
+		levels := [6]uint8{0, 95, 135, 175, 215, 255}
+		i -= 16
+		return color.RGBA{levels[i/36], levels[i/6%6], levels[i%6], 255}
+	default:
+		return color.RGBA{0, 0, 0, 255}
+	}
+}
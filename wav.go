@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"time"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+const (
+	wavHeaderSize    = 44
+	wavChannels      = 1
+	wavBitsPerSample = 16
+	wavSyncInterval  = time.Second
+)
+
+// wavWriter writes mono 16-bit PCM to a RIFF/WAVE file. The header is
+// rewritten on every sync so that the file stays playable even if the process
+// dies before Close; the sample rate is taken from the first frame.
+type wavWriter struct {
+	file     *os.File
+	buf      *bufio.Writer
+	dataSize uint32
+	lastSync time.Time
+	rateLock
+}
+
+func createWAV(path string) (*wavWriter, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &wavWriter{
+		file: file,
+		buf:  bufio.NewWriter(file),
+	}
+
+	if err := w.writeHeader(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(wavHeaderSize, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *wavWriter) writeHeader() error {
+	blockAlign := wavChannels * wavBitsPerSample / 8
+
+	var header [wavHeaderSize]byte
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], wavHeaderSize-8+w.dataSize)
+	copy(header[8:], "WAVE")
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], wavChannels)
+	binary.LittleEndian.PutUint32(header[24:], uint32(w.rate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(w.rate*blockAlign))
+	binary.LittleEndian.PutUint16(header[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(header[34:], wavBitsPerSample)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], w.dataSize)
+
+	_, err := w.file.WriteAt(header[:], 0)
+	return err
+}
+
+func (w *wavWriter) WriteAudio(frame owrx.AudioFrame) error {
+	if !w.accept(frame) {
+		return nil
+	}
+
+	if err := binary.Write(w.buf, binary.LittleEndian, frame.Samples); err != nil {
+		return err
+	}
+	w.dataSize += uint32(len(frame.Samples) * 2)
+
+	if time.Since(w.lastSync) >= wavSyncInterval {
+		return w.sync()
+	}
+	return nil
+}
+
+func (w *wavWriter) duration() time.Duration {
+	if w.rate == 0 {
+		return 0
+	}
+	samples := time.Duration(w.dataSize / (wavBitsPerSample / 8))
+	return samples * time.Second / time.Duration(w.rate)
+}
+
+func (w *wavWriter) sync() error {
+	w.lastSync = time.Now()
+
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.writeHeader()
+}
+
+func (w *wavWriter) Close() error {
+	err := w.sync()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
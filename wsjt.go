@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+// decoderClosers are the outputs of the secondary decoders, closed on exit.
+var decoderClosers []io.Closer
+
+func setupDecoderOutputs() {
+	if *wsprCSV != "" {
+		w, err := openEventCSV("WSPR", *wsprCSV, wsprCSVHeader)
+		if err != nil {
+			fatalf("Failed to open %s: %v", *wsprCSV, err)
+		}
+		wsprOutput = w
+		decoderClosers = append(decoderClosers, w)
+	}
+	if *ft8CSV != "" {
+		w, err := openEventCSV("FT8", *ft8CSV, ft8CSVHeader)
+		if err != nil {
+			fatalf("Failed to open %s: %v", *ft8CSV, err)
+		}
+		ft8Output = w
+		decoderClosers = append(decoderClosers, w)
+	}
+}
+
+func closeDecoderOutputs() {
+	flushFT8()
+	for _, c := range decoderClosers {
+		if err := c.Close(); err != nil {
+			errorf("%v", err)
+		}
+	}
+	decoderClosers = nil
+}
+
+// handleWsjt routes a decode of one of the WSJT-X modes by its mode. Modes
+// without their own output are logged as is.
+func handleWsjt(d owrx.WsjtDecode) {
+	received := time.Now()
+	switch strings.ToUpper(d.Mode) {
+	case "WSPR":
+		handleWspr(d, received)
+	case "FT8", "FT4":
+		handleFT8(d, received)
+	default:
+		infof("Secondary %s: %s", strings.ToLower(d.Mode), strings.TrimSpace(d.Message))
+	}
+}
+
+// wsjtCycle is the start of the cycle a decode was made in, which the server
+// sends in milliseconds.
+func wsjtCycle(d owrx.WsjtDecode) time.Time {
+	if d.Timestamp == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(d.Timestamp)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"net.wadon/owrxp-playground/owrx"
+)
+
+var wsprCSVHeader = []string{"received", "cycle", "callsign", "grid", "power_dbm", "frequency", "snr", "dt", "drift"}
+
+// wsprOutput is the -wspr-csv file, if any.
+var wsprOutput *eventCSVWriter
+
+// wsprSpot is a WSPR transmission heard by the receiver. Received is when
+// the client got it, Cycle the start of the two minute cycle it was sent in.
+type wsprSpot struct {
+	Received  time.Time `json:"received"`
+	Cycle     time.Time `json:"cycle"`
+	Callsign  string    `json:"callsign"`
+	Grid      string    `json:"grid,omitempty"`
+	Power     *int      `json:"power_dbm,omitempty"`
+	Frequency int64     `json:"frequency"`
+	SNR       float64   `json:"snr"`
+	DT        float64   `json:"dt"`
+	Drift     int       `json:"drift"`
+}
+
+// handleWspr logs a WSPR spot, adds it to the -json dump and appends it to
+// -wspr-csv.
+func handleWspr(d owrx.WsjtDecode, received time.Time) {
+	spot, ok := parseWsprSpot(d)
+	if !ok {
+		debugf("ignoring WSPR decode without a callsign: %q", d.Message)
+		return
+	}
+	spot.Received = received
+
+	infof("WSPR %s", spot)
+	dumpEvent("wspr", spot)
+	recordDecoded("wspr", spot)
+	if wsprOutput != nil {
+		wsprOutput.write(spot.row())
+	}
+}
+
+// parseWsprSpot makes a spot of a decode. The message is the callsign, the
+// grid and the power in dBm, though compound callsigns are sent without the
+// grid and hashed ones come in angle brackets. The callsign and grid the
+// server made out, if any, win over the ones read here.
+func parseWsprSpot(d owrx.WsjtDecode) (wsprSpot, bool) {
+	spot := wsprSpot{
+		Cycle:     wsjtCycle(d),
+		Frequency: d.Frequency,
+		SNR:       d.DB,
+		DT:        d.DT,
+		Drift:     d.Drift,
+	}
+
+	fields := strings.Fields(d.Message)
+	if n := len(fields); n >= 2 {
+		if power, err := strconv.Atoi(fields[n-1]); err == nil {
+			spot.Power = &power
+			fields = fields[:n-1]
+		}
+	}
+	if len(fields) > 0 {
+		spot.Callsign = strings.Trim(fields[0], "<>")
+	}
+	if len(fields) > 1 {
+		spot.Grid = fields[1]
+	}
+
+	if d.Callsign != "" {
+		spot.Callsign = d.Callsign
+	}
+	if d.Locator != "" {
+		spot.Grid = d.Locator
+	}
+	return spot, spot.Callsign != ""
+}
+
+func (s wsprSpot) String() string {
+	text := s.Callsign
+	if s.Grid != "" {
+		text += " " + s.Grid
+	}
+	if s.Power != nil {
+		text += fmt.Sprintf(" %d dBm", *s.Power)
+	}
+	return text + fmt.Sprintf(" on %.6f MHz, SNR %.0f dB, dt %.1f s, drift %d Hz", float64(s.Frequency)/1e6, s.SNR, s.DT, s.Drift)
+}
+
+func (s wsprSpot) row() []string {
+	var cycle, power string
+	if !s.Cycle.IsZero() {
+		cycle = s.Cycle.UTC().Format(time.RFC3339)
+	}
+	if s.Power != nil {
+		power = strconv.Itoa(*s.Power)
+	}
+	return []string{
+		s.Received.Format(time.RFC3339Nano),
+		cycle,
+		s.Callsign,
+		s.Grid,
+		power,
+		strconv.FormatInt(s.Frequency, 10),
+		strconv.FormatFloat(s.SNR, 'g', -1, 64),
+		strconv.FormatFloat(s.DT, 'g', -1, 64),
+		strconv.Itoa(s.Drift),
+	}
+}